@@ -0,0 +1,52 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrActivationPending is returned by ActivationResult if activation has not yet finished.
+var ErrActivationPending = errors.New("Activation has not finished")
+
+// ErrShutdownBeforeActivation is returned by ActivationResult if shutdown started before the object
+// was activated.
+var ErrShutdownBeforeActivation = errors.New("Shutdown started before activation")
+
+// StartActivate begins activation in the background, as with DoOnceActivate, and returns immediately.
+// Use ActivationDoneChan and ActivationResult to learn the outcome. This allows an orchestrator to activate
+// many objects concurrently, and to select over their activation along with ShutdownStartedChan.
+func (h *Helper) StartActivate(onceActivateCallback OnceActivateCallback) {
+	go h.DoOnceActivate(onceActivateCallback, false)
+}
+
+// StartActivateContext is the same as StartActivate, except that the activation callback receives a
+// context as with DoOnceActivateContext.
+func (h *Helper) StartActivateContext(ctx context.Context, onceActivateCallback OnceActivateContextCallback) {
+	go h.DoOnceActivateContext(ctx, onceActivateCallback, false)
+}
+
+// ActivationDoneChan returns a chan that is closed when the object leaves StateActivating (or
+// StateUnactivated), whether because activation succeeded, activation failed, or shutdown started first.
+// A failed activation closes it at once, even if shutdown is held off by a deferral (see DeferShutdown).
+// When it is closed, ActivationResult no longer returns ErrActivationPending.
+func (h *Helper) ActivationDoneChan() <-chan struct{} {
+	return h.activatingDoneChan
+}
+
+// ActivationResult returns nil if the object has been successfully activated, the activation error if
+// activation failed, ErrShutdownBeforeActivation if shutdown started before activation, or
+// ErrActivationPending if activation has not yet finished.
+func (h *Helper) ActivationResult() error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.isActivated {
+		return nil
+	}
+	if h.activationErr != nil {
+		return h.activationErr
+	}
+	if h.lockedIsStartedShutdown() {
+		return ErrShutdownBeforeActivation
+	}
+	return ErrActivationPending
+}
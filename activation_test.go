@@ -0,0 +1,73 @@
+package asyncobj
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// awaitChan fails the test if c is not closed within a second
+func awaitChan(t *testing.T, c <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatalf("%s was not closed", what)
+	}
+}
+
+func TestStartActivate(t *testing.T) {
+	h := newTestHelper()
+	release := make(chan struct{})
+	h.StartActivate(func() error {
+		<-release
+		return nil
+	})
+	if err := h.ActivationResult(); err != ErrActivationPending {
+		t.Fatalf("ActivationResult returned %v during activation", err)
+	}
+	close(release)
+	awaitChan(t, h.ActivationDoneChan(), "ActivationDoneChan")
+	if err := h.ActivationResult(); err != nil {
+		t.Fatalf("ActivationResult returned %v after successful activation", err)
+	}
+	h.Shutdown(nil)
+
+	h = newTestHelper()
+	h.StartShutdown(nil)
+	awaitChan(t, h.ActivationDoneChan(), "ActivationDoneChan")
+	if err := h.ActivationResult(); err != ErrShutdownBeforeActivation {
+		t.Fatalf("ActivationResult returned %v; expected ErrShutdownBeforeActivation", err)
+	}
+}
+
+func TestActivationFailureWhileDeferred(t *testing.T) {
+	activateErr := errors.New("activation error")
+	h := newTestHelper()
+	if err := h.DeferShutdown(); err != nil {
+		t.Fatalf("DeferShutdown failed: %s", err)
+	}
+	h.StartActivate(func() error { return activateErr })
+	awaitChan(t, h.ActivationDoneChan(), "ActivationDoneChan")
+	if err := h.ActivationResult(); err != activateErr {
+		t.Fatalf("ActivationResult returned %v; expected the activation error", err)
+	}
+	if h.IsStartedShutdown() {
+		t.Fatal("Shutdown started while deferred")
+	}
+	// A later caller gets the same result without blocking
+	done := make(chan error, 1)
+	go func() { done <- h.DoOnceActivate(func() error { return nil }, false) }()
+	select {
+	case err := <-done:
+		if err != activateErr {
+			t.Fatalf("DoOnceActivate returned %v; expected the activation error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DoOnceActivate blocked after failed activation")
+	}
+	h.UndeferShutdown()
+	if err := h.WaitShutdown(); err != activateErr {
+		t.Fatalf("WaitShutdown returned %v; expected the activation error", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package asyncobjtest provides tools for testing code built on package asyncobj, including conformance
+// suites that check that an implementation of asyncobj.AsyncShutdowner or asyncobj.AsyncHelper honors
+// the contracts that other asyncobj code depends on.
+package asyncobjtest
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sammck-go/asyncobj"
+)
+
+// Timeout is the longest time the conformance suites will wait for an object to do something it is
+// required to do, such as complete shutdown after StartShutdown is called, before failing the test.
+var Timeout = 10 * time.Second
+
+// ShutdownerFactory creates a new instance of the AsyncShutdowner under test. Each call must return a
+// new object that has not been shut down, and that will complete shutdown promptly once StartShutdown
+// is called without any further help from the caller.
+type ShutdownerFactory func() asyncobj.AsyncShutdowner
+
+// RunConformance runs a suite of subtests against new objects created by factory, checking the
+// AsyncShutdowner contract:
+//
+//     StartShutdown returns true exactly once, even when called concurrently
+//     ShutdownDoneChan is closed after shutdown is started, and is the same chan on every call
+//     WaitShutdown blocks until ShutdownDoneChan is closed, then always returns the same completion status
+//     If the object implements io.Closer, Close shuts the object down and returns the same status
+//     as WaitShutdown, and is idempotent
+func RunConformance(t *testing.T, factory ShutdownerFactory) {
+	t.Run("StartShutdownIdempotent", func(t *testing.T) {
+		obj := factory()
+		if !obj.StartShutdown(nil) {
+			t.Fatal("First call to StartShutdown returned false")
+		}
+		for i := 0; i < 3; i++ {
+			if obj.StartShutdown(nil) {
+				t.Fatal("Subsequent call to StartShutdown returned true")
+			}
+		}
+		awaitShutdownDone(t, obj)
+		if obj.StartShutdown(nil) {
+			t.Fatal("StartShutdown returned true after shutdown was complete")
+		}
+	})
+
+	t.Run("StartShutdownConcurrent", func(t *testing.T) {
+		obj := factory()
+		const n = 16
+		var wg sync.WaitGroup
+		results := make(chan bool, n)
+		start := make(chan struct{})
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				results <- obj.StartShutdown(nil)
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(results)
+		started := 0
+		for r := range results {
+			if r {
+				started++
+			}
+		}
+		if started != 1 {
+			t.Fatalf("%d concurrent calls to StartShutdown returned true; expected exactly 1", started)
+		}
+		awaitShutdownDone(t, obj)
+	})
+
+	t.Run("ShutdownDoneChan", func(t *testing.T) {
+		obj := factory()
+		doneChan := obj.ShutdownDoneChan()
+		if isClosed(doneChan) {
+			t.Fatal("ShutdownDoneChan was closed before shutdown was started")
+		}
+		obj.StartShutdown(nil)
+		awaitShutdownDone(t, obj)
+		if obj.ShutdownDoneChan() != doneChan {
+			t.Fatal("ShutdownDoneChan returned a different chan after shutdown")
+		}
+	})
+
+	t.Run("WaitShutdownAfterDone", func(t *testing.T) {
+		obj := factory()
+		obj.StartShutdown(nil)
+		awaitShutdownDone(t, obj)
+		err := mustNotBlock(t, "WaitShutdown after ShutdownDoneChan was closed", obj.WaitShutdown)
+		for i := 0; i < 3; i++ {
+			err2 := mustNotBlock(t, "WaitShutdown after ShutdownDoneChan was closed", obj.WaitShutdown)
+			if err2 != err {
+				t.Fatalf("WaitShutdown returned %v, then %v", err, err2)
+			}
+		}
+	})
+
+	t.Run("WaitShutdownBlocksUntilDone", func(t *testing.T) {
+		obj := factory()
+		const n = 4
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			go func() {
+				err := obj.WaitShutdown()
+				if !isClosed(obj.ShutdownDoneChan()) {
+					t.Error("WaitShutdown returned before ShutdownDoneChan was closed")
+				}
+				errs <- err
+			}()
+		}
+		obj.StartShutdown(nil)
+		awaitShutdownDone(t, obj)
+		final := obj.WaitShutdown()
+		for i := 0; i < n; i++ {
+			select {
+			case err := <-errs:
+				if err != final {
+					t.Fatalf("Concurrent WaitShutdown returned %v; expected %v", err, final)
+				}
+			case <-time.After(Timeout):
+				t.Fatal("WaitShutdown did not return after ShutdownDoneChan was closed")
+			}
+		}
+	})
+
+	if _, ok := factory().(io.Closer); !ok {
+		return
+	}
+
+	t.Run("Close", func(t *testing.T) {
+		obj := factory()
+		closer := obj.(io.Closer)
+		err := mustNotBlock(t, "Close", closer.Close)
+		if !isClosed(obj.ShutdownDoneChan()) {
+			t.Fatal("ShutdownDoneChan was not closed when Close returned")
+		}
+		if obj.StartShutdown(nil) {
+			t.Fatal("StartShutdown returned true after Close")
+		}
+		if err2 := obj.WaitShutdown(); err2 != err {
+			t.Fatalf("Close returned %v but WaitShutdown returned %v", err, err2)
+		}
+		if err2 := mustNotBlock(t, "second Close", closer.Close); err2 != err {
+			t.Fatalf("Close returned %v, then %v", err, err2)
+		}
+	})
+
+	t.Run("CloseAfterStartShutdown", func(t *testing.T) {
+		obj := factory()
+		obj.StartShutdown(nil)
+		err := mustNotBlock(t, "Close", obj.(io.Closer).Close)
+		if err2 := obj.WaitShutdown(); err2 != err {
+			t.Fatalf("Close returned %v but WaitShutdown returned %v", err, err2)
+		}
+	})
+}
+
+// isClosed returns true if c is closed, without blocking
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// awaitClosed fails the test if c is not closed within Timeout
+func awaitClosed(t testing.TB, c <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-c:
+	case <-time.After(Timeout):
+		t.Fatalf("%s was not closed within %s", what, Timeout)
+	}
+}
+
+// awaitShutdownDone fails the test if obj does not finish shutting down within Timeout
+func awaitShutdownDone(t testing.TB, obj asyncobj.AsyncShutdowner) {
+	t.Helper()
+	awaitClosed(t, obj.ShutdownDoneChan(), "ShutdownDoneChan")
+}
+
+// mustNotBlock calls fn and returns its result, failing the test if fn does not return within Timeout
+func mustNotBlock(t testing.TB, what string, fn func() error) error {
+	t.Helper()
+	result := make(chan error, 1)
+	go func() {
+		result <- fn()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(Timeout):
+		t.Fatalf("%s did not return within %s", what, Timeout)
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package asyncobjtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sammck-go/asyncobj"
+)
+
+// plainObject is a minimal object managed by a Helper created with NewHelper
+type plainObject struct{}
+
+// HandleOnceShutdown returns the advisory completion status
+func (plainObject) HandleOnceShutdown(completionErr error) error {
+	return completionErr
+}
+
+func TestConformanceNewHelper(t *testing.T) {
+	RunHelperConformance(t, func() asyncobj.AsyncHelper {
+		return asyncobj.NewHelper(nil, plainObject{})
+	})
+}
+
+func TestConformanceShutdownHandler(t *testing.T) {
+	RunConformance(t, func() asyncobj.AsyncShutdowner {
+		return asyncobj.NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+			return completionErr
+		})
+	})
+}
+
+func TestConformanceFakeObject(t *testing.T) {
+	RunHelperConformance(t, func() asyncobj.AsyncHelper {
+		return NewFakeObject(nil)
+	})
+}
+
+func TestFakeObjectGates(t *testing.T) {
+	f := NewFakeObject(nil)
+	activateGate := f.HoldActivate()
+	shutdownGate := f.HoldShutdown()
+	shutdownErr := errors.New("fake shutdown error")
+	f.SetShutdownErr(shutdownErr)
+
+	activated := make(chan error, 1)
+	go func() {
+		activated <- f.DoOnceActivate(nil, true)
+	}()
+	awaitClosed(t, activateGate.Entered(), "activation gate")
+	AwaitState(t, f, asyncobj.StateActivating, Timeout)
+	f.StartShutdown(nil)
+	activateGate.Release()
+	if err := <-activated; err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+
+	awaitClosed(t, shutdownGate.Entered(), "shutdown gate")
+	AwaitState(t, f, asyncobj.StateShuttingDown, Timeout)
+	shutdownGate.Release()
+	if err := f.WaitShutdown(); err != shutdownErr {
+		t.Fatalf("WaitShutdown returned %v; expected %v", err, shutdownErr)
+	}
+
+	AssertTransitions(t, f, []asyncobj.State{
+		asyncobj.StateUnactivated,
+		asyncobj.StateActivating,
+		asyncobj.StateActivated,
+		asyncobj.StateShuttingDown,
+		asyncobj.StateLocalShutdown,
+		asyncobj.StateShutDown,
+	})
+	calls := f.Calls()
+	if len(calls) != 2 || calls[0].Method != "HandleOnceActivate" || calls[1].Method != "HandleOnceShutdown" {
+		t.Fatalf("Unexpected handler calls %v", calls)
+	}
+}
+
+func TestFakeObjectActivateErr(t *testing.T) {
+	f := NewFakeObject(nil)
+	activateErr := errors.New("fake activation error")
+	f.SetActivateErr(activateErr)
+	if err := f.DoOnceActivate(nil, true); err != activateErr {
+		t.Fatalf("DoOnceActivate returned %v; expected %v", err, activateErr)
+	}
+	AssertTransitions(t, f, []asyncobj.State{
+		asyncobj.StateUnactivated,
+		asyncobj.StateActivating,
+		asyncobj.StateShuttingDown,
+		asyncobj.StateLocalShutdown,
+		asyncobj.StateShutDown,
+	})
+}
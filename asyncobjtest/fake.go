@@ -0,0 +1,180 @@
+package asyncobjtest
+
+import (
+	"sync"
+
+	"github.com/sammck-go/asyncobj"
+	"github.com/sammck-go/logger"
+)
+
+// Gate holds a FakeObject callback until the test releases it, so that tests can observe and act on an
+// object while it is in StateActivating or StateShuttingDown.
+type Gate struct {
+	// entered is closed when a callback reaches the gate
+	entered chan struct{}
+
+	// released is closed when the test releases the gate
+	released chan struct{}
+
+	enteredOnce  sync.Once
+	releasedOnce sync.Once
+}
+
+// NewGate creates a new Gate that holds callbacks until it is released.
+func NewGate() *Gate {
+	return &Gate{
+		entered:  make(chan struct{}),
+		released: make(chan struct{}),
+	}
+}
+
+// Entered returns a chan that is closed when a callback reaches the gate.
+func (g *Gate) Entered() <-chan struct{} {
+	return g.entered
+}
+
+// Release allows callbacks held at the gate, and any that reach it in the future, to proceed. It is
+// safe to call Release more than once.
+func (g *Gate) Release() {
+	g.releasedOnce.Do(func() {
+		close(g.released)
+	})
+}
+
+// pass signals that a callback has reached the gate and waits for the gate to be released.
+func (g *Gate) pass() {
+	g.enteredOnce.Do(func() {
+		close(g.entered)
+	})
+	<-g.released
+}
+
+// Call records a call made by a Helper to one of a FakeObject's handlers.
+type Call struct {
+	// Method is the name of the handler method that was called
+	Method string
+
+	// Err is the advisory completion status passed to HandleOnceShutdown, or nil
+	Err error
+}
+
+// FakeObject is an *asyncobj.Helper whose activation and shutdown handlers are controlled by the test.
+// Its handlers record each call, optionally block on a Gate, and return scripted errors. The state transitions
+// of its Helper are recorded from the time it is created, so FakeObject can be passed to AssertTransitions.
+type FakeObject struct {
+	*asyncobj.Helper
+
+	// lock protects the remaining fields
+	lock sync.Mutex
+
+	// activateGate, if not nil, holds HandleOnceActivate until released
+	activateGate *Gate
+
+	// shutdownGate, if not nil, holds HandleOnceShutdown until released
+	shutdownGate *Gate
+
+	// activateErr is returned from HandleOnceActivate
+	activateErr error
+
+	// shutdownErr, if not nil, is returned from HandleOnceShutdown in place of the advisory completion status
+	shutdownErr error
+
+	// calls records handler calls, in order
+	calls []Call
+
+	// recorder records the state transitions of the Helper
+	recorder *TransitionRecorder
+}
+
+// NewFakeObject creates a new FakeObject in StateUnactivated whose handlers succeed immediately until
+// configured otherwise.
+// if logger is nil, a NilLogger is attached.
+func NewFakeObject(logger logger.Logger) *FakeObject {
+	f := &FakeObject{}
+	f.Helper = asyncobj.NewHelper(logger, f).(*asyncobj.Helper)
+	f.recorder = RecordTransitions(f.Helper)
+	return f
+}
+
+// HoldActivate causes HandleOnceActivate to block until the returned Gate is released.
+// Must be called before activation begins.
+func (f *FakeObject) HoldActivate() *Gate {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.activateGate = NewGate()
+	return f.activateGate
+}
+
+// HoldShutdown causes HandleOnceShutdown to block until the returned Gate is released.
+// Must be called before shutdown begins.
+func (f *FakeObject) HoldShutdown() *Gate {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.shutdownGate = NewGate()
+	return f.shutdownGate
+}
+
+// SetActivateErr sets the error that HandleOnceActivate will return.
+func (f *FakeObject) SetActivateErr(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.activateErr = err
+}
+
+// SetShutdownErr sets the error that HandleOnceShutdown will return. If err is nil (the default),
+// HandleOnceShutdown returns its advisory completion status.
+func (f *FakeObject) SetShutdownErr(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.shutdownErr = err
+}
+
+// Calls returns the handler calls made so far, in order.
+func (f *FakeObject) Calls() []Call {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// States returns the states the Helper has entered since the FakeObject was created, starting with StateUnactivated.
+func (f *FakeObject) States() []asyncobj.State {
+	return f.recorder.States()
+}
+
+// Changed returns a chan that is closed the next time the Helper enters a new state.
+func (f *FakeObject) Changed() <-chan struct{} {
+	return f.recorder.Changed()
+}
+
+// HandleOnceActivate records the call, waits for the activation gate if one has been set, and returns
+// the scripted activation error.
+func (f *FakeObject) HandleOnceActivate() error {
+	f.lock.Lock()
+	f.calls = append(f.calls, Call{Method: "HandleOnceActivate"})
+	gate := f.activateGate
+	f.lock.Unlock()
+	if gate != nil {
+		gate.pass()
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.activateErr
+}
+
+// HandleOnceShutdown records the call, waits for the shutdown gate if one has been set, and returns the
+// scripted shutdown error, or completionErr if none has been set.
+func (f *FakeObject) HandleOnceShutdown(completionErr error) error {
+	f.lock.Lock()
+	f.calls = append(f.calls, Call{Method: "HandleOnceShutdown", Err: completionErr})
+	gate := f.shutdownGate
+	f.lock.Unlock()
+	if gate != nil {
+		gate.pass()
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.shutdownErr != nil {
+		return f.shutdownErr
+	}
+	return completionErr
+}
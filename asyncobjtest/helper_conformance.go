@@ -0,0 +1,313 @@
+package asyncobjtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sammck-go/asyncobj"
+)
+
+// HelperFactory creates a new instance of the AsyncHelper under test. Each call must return a new object
+// in StateUnactivated whose shutdown handler completes promptly without any further help from the caller.
+type HelperFactory func() asyncobj.AsyncHelper
+
+// errConformance is the error used by the conformance suites wherever an arbitrary error is needed
+var errConformance = errors.New("asyncobjtest conformance error")
+
+// suspender is implemented by objects that can be suspended and resumed, including *asyncobj.Helper and all
+// objects that embed one
+type suspender interface {
+	Suspend(ctx context.Context) error
+	Resume(ctx context.Context) error
+}
+
+// conformanceChild is a simple io.Closer child used to check child registration rules
+type conformanceChild struct {
+	closed chan struct{}
+}
+
+func newConformanceChild() *conformanceChild {
+	return &conformanceChild{closed: make(chan struct{})}
+}
+
+// Close records that the child has been closed
+func (c *conformanceChild) Close() error {
+	close(c.closed)
+	return nil
+}
+
+// RunHelperConformance runs RunConformance against new objects created by factory, followed by a suite
+// of subtests checking the rest of the AsyncHelper contract:
+//
+//     States only increase, except on Resume, and activation happens at most once
+//     Suspend and Resume, if implemented, move between StateActivated and StateSuspended, and a suspended object shuts down
+//     A failed activation starts shutdown with the activation error
+//     Shutdown is held off while deferred, and cannot be deferred once started
+//     The shutdown chans are closed in order, consistent with the Is... methods
+//     Children are shut down after StateLocalShutdown and before StateShutDown
+//     Children and ShutdownWG counts cannot be added after StateShutDown
+func RunHelperConformance(t *testing.T, factory HelperFactory) {
+	RunConformance(t, func() asyncobj.AsyncShutdowner {
+		return factory()
+	})
+
+	t.Run("Activation", func(t *testing.T) {
+		h := factory()
+		if state := h.GetAsyncObjState(); state != asyncobj.StateUnactivated {
+			t.Fatalf("New object is in %s", state)
+		}
+		calls := 0
+		activate := func() error {
+			calls++
+			if state := h.GetAsyncObjState(); state != asyncobj.StateActivating {
+				t.Errorf("Activation callback called in %s", state)
+			}
+			return nil
+		}
+		if err := h.DoOnceActivate(activate, true); err != nil {
+			t.Fatalf("DoOnceActivate failed: %s", err)
+		}
+		if !h.IsActivated() {
+			t.Fatal("IsActivated returned false after successful activation")
+		}
+		if state := h.GetAsyncObjState(); state != asyncobj.StateActivated {
+			t.Fatalf("Object is in %s after successful activation", state)
+		}
+		if err := h.DoOnceActivate(activate, true); err != nil {
+			t.Fatalf("Second DoOnceActivate failed: %s", err)
+		}
+		if calls != 1 {
+			t.Fatalf("Activation callback called %d times", calls)
+		}
+		mustNotBlock(t, "Shutdown", func() error { return h.Shutdown(nil) })
+		if !h.IsActivated() {
+			t.Fatal("IsActivated returned false after shutdown")
+		}
+	})
+
+	t.Run("ActivationFailure", func(t *testing.T) {
+		h := factory()
+		err := mustNotBlock(t, "DoOnceActivate", func() error {
+			return h.DoOnceActivate(func() error { return errConformance }, true)
+		})
+		if !errors.Is(err, errConformance) {
+			t.Fatalf("DoOnceActivate returned %v; expected the activation error", err)
+		}
+		if !isClosed(h.ShutdownDoneChan()) {
+			t.Fatal("Shutdown was not complete when DoOnceActivate returned with waitOnFail")
+		}
+		if h.IsActivated() {
+			t.Fatal("IsActivated returned true after failed activation")
+		}
+		if err := h.DoOnceActivate(func() error { return nil }, true); err == nil {
+			t.Fatal("DoOnceActivate succeeded after shutdown")
+		}
+	})
+
+	t.Run("ActivationAfterShutdown", func(t *testing.T) {
+		h := factory()
+		h.StartShutdown(nil)
+		called := false
+		err := mustNotBlock(t, "DoOnceActivate", func() error {
+			return h.DoOnceActivate(func() error { called = true; return nil }, true)
+		})
+		if err == nil {
+			t.Fatal("DoOnceActivate succeeded after shutdown was started")
+		}
+		if called {
+			t.Fatal("Activation callback called after shutdown was started")
+		}
+	})
+
+	t.Run("Suspend", func(t *testing.T) {
+		h := factory()
+		s, ok := h.(suspender)
+		if !ok {
+			t.Skip("Object does not implement Suspend and Resume")
+		}
+		if err := s.Suspend(context.Background()); err == nil {
+			t.Fatal("Suspend succeeded before activation")
+		}
+		if err := h.DoOnceActivate(func() error { return nil }, true); err != nil {
+			t.Fatalf("DoOnceActivate failed: %s", err)
+		}
+		if err := s.Resume(context.Background()); err != nil {
+			t.Fatalf("Resume of an object that is not suspended failed: %s", err)
+		}
+		// Transitions are checked only if the object supports state observers
+		observable, canObserve := h.(Observable)
+		var rec *TransitionRecorder
+		if canObserve {
+			rec = RecordTransitions(observable)
+		}
+		if err := s.Suspend(context.Background()); err != nil {
+			t.Fatalf("Suspend failed: %s", err)
+		}
+		if state := h.GetAsyncObjState(); state != asyncobj.StateSuspended {
+			t.Fatalf("Object is in %s after Suspend", state)
+		}
+		if err := s.Resume(context.Background()); err != nil {
+			t.Fatalf("Resume failed: %s", err)
+		}
+		if state := h.GetAsyncObjState(); state != asyncobj.StateActivated {
+			t.Fatalf("Object is in %s after Resume", state)
+		}
+		if err := s.Suspend(context.Background()); err != nil {
+			t.Fatalf("Second Suspend failed: %s", err)
+		}
+		mustNotBlock(t, "Shutdown", func() error { return h.Shutdown(nil) })
+		if canObserve {
+			AssertTransitions(t, rec, []asyncobj.State{
+				asyncobj.StateActivated,
+				asyncobj.StateSuspending,
+				asyncobj.StateSuspended,
+				asyncobj.StateActivated,
+				asyncobj.StateSuspending,
+				asyncobj.StateSuspended,
+				asyncobj.StateShuttingDown,
+				asyncobj.StateLocalShutdown,
+				asyncobj.StateShutDown,
+			})
+		}
+		if err := s.Resume(context.Background()); err == nil {
+			t.Fatal("Resume succeeded after shutdown")
+		}
+	})
+
+	t.Run("DeferShutdown", func(t *testing.T) {
+		h := factory()
+		if err := h.DeferShutdown(); err != nil {
+			t.Fatalf("DeferShutdown failed: %s", err)
+		}
+		if err := h.DeferShutdown(); err != nil {
+			t.Fatalf("Second DeferShutdown failed: %s", err)
+		}
+		if !h.StartShutdown(errConformance) {
+			t.Fatal("StartShutdown returned false while deferred")
+		}
+		if !h.IsScheduledShutdown() {
+			t.Fatal("IsScheduledShutdown returned false after StartShutdown")
+		}
+		h.UndeferShutdown()
+		if h.IsStartedShutdown() || isClosed(h.ShutdownStartedChan()) {
+			t.Fatal("Shutdown started while still deferred")
+		}
+		if state := h.GetAsyncObjState(); state >= asyncobj.StateShuttingDown {
+			t.Fatalf("Object entered %s while shutdown was deferred", state)
+		}
+		h.UndeferShutdown()
+		awaitShutdownDone(t, h)
+		if err := h.DeferShutdown(); err == nil {
+			t.Fatal("DeferShutdown succeeded after shutdown started")
+		}
+	})
+
+	t.Run("ChanOrdering", func(t *testing.T) {
+		h := factory()
+		if h.IsScheduledShutdown() || h.IsStartedShutdown() || h.IsDoneLocalShutdown() || h.IsDoneShutdown() {
+			t.Fatal("New object reports shutdown progress")
+		}
+		ordered := make(chan error, 1)
+		go func() {
+			<-h.LocalShutdownDoneChan()
+			if !isClosed(h.ShutdownStartedChan()) {
+				ordered <- errors.New("LocalShutdownDoneChan closed before ShutdownStartedChan")
+				return
+			}
+			<-h.ShutdownDoneChan()
+			if !isClosed(h.LocalShutdownDoneChan()) {
+				ordered <- errors.New("ShutdownDoneChan closed before LocalShutdownDoneChan")
+				return
+			}
+			ordered <- nil
+		}()
+		h.StartShutdown(nil)
+		awaitClosed(t, h.ShutdownStartedChan(), "ShutdownStartedChan")
+		if !h.IsScheduledShutdown() || !h.IsStartedShutdown() {
+			t.Fatal("Is...Shutdown inconsistent with ShutdownStartedChan")
+		}
+		awaitClosed(t, h.LocalShutdownDoneChan(), "LocalShutdownDoneChan")
+		if !h.IsDoneLocalShutdown() {
+			t.Fatal("IsDoneLocalShutdown inconsistent with LocalShutdownDoneChan")
+		}
+		awaitShutdownDone(t, h)
+		if !h.IsDoneShutdown() {
+			t.Fatal("IsDoneShutdown inconsistent with ShutdownDoneChan")
+		}
+		if state := h.GetAsyncObjState(); state != asyncobj.StateShutDown {
+			t.Fatalf("Object is in %s after ShutdownDoneChan was closed", state)
+		}
+		if err := <-ordered; err != nil {
+			t.Fatal(err)
+		}
+		if err := mustNotBlock(t, "WaitLocalShutdown", h.WaitLocalShutdown); err != h.WaitLocalShutdown() {
+			t.Fatal("WaitLocalShutdown is not consistent")
+		}
+	})
+
+	t.Run("Children", func(t *testing.T) {
+		h := factory()
+		childDoneChan := make(chan struct{})
+		if _, err := h.AddShutdownChildChan(childDoneChan); err != nil {
+			t.Fatalf("AddShutdownChildChan failed: %s", err)
+		}
+		closer := newConformanceChild()
+		if _, err := h.AddSyncCloseChild(closer); err != nil {
+			t.Fatalf("AddSyncCloseChild failed: %s", err)
+		}
+		asyncChildStarted := make(chan struct{})
+		asyncChild := asyncobj.NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+			if !isClosed(h.LocalShutdownDoneChan()) {
+				t.Error("Async child shut down before parent's local shutdown was complete")
+			}
+			close(asyncChildStarted)
+			return nil
+		})
+		if _, err := h.AddAsyncShutdownChild(asyncChild); err != nil {
+			t.Fatalf("AddAsyncShutdownChild failed: %s", err)
+		}
+		h.StartShutdown(nil)
+		awaitClosed(t, asyncChildStarted, "Async child shutdown")
+		awaitClosed(t, closer.closed, "Closer child shutdown")
+		awaitShutdownDone(t, asyncChild)
+		if isClosed(h.ShutdownDoneChan()) {
+			t.Fatal("Shutdown completed before child done chan was closed")
+		}
+		close(childDoneChan)
+		awaitShutdownDone(t, h)
+
+		if _, err := h.AddShutdownChildChan(make(chan struct{})); err == nil {
+			t.Fatal("AddShutdownChildChan succeeded after shutdown")
+		}
+		if _, err := h.AddSyncCloseChild(newConformanceChild()); err == nil {
+			t.Fatal("AddSyncCloseChild succeeded after shutdown")
+		}
+		if _, err := h.AddAsyncShutdownChild(asyncobj.NewHelperWithShutdownHandler(nil, nil, func(err error) error {
+			return err
+		})); err == nil {
+			t.Fatal("AddAsyncShutdownChild succeeded after shutdown")
+		}
+	})
+
+	t.Run("ShutdownWG", func(t *testing.T) {
+		h := factory()
+		if _, err := h.ShutdownWGAdd(0); err == nil {
+			t.Fatal("ShutdownWGAdd(0) succeeded")
+		}
+		wg, err := h.ShutdownWGAdd(1)
+		if err != nil {
+			t.Fatalf("ShutdownWGAdd failed: %s", err)
+		}
+		h.StartShutdown(nil)
+		awaitClosed(t, h.LocalShutdownDoneChan(), "LocalShutdownDoneChan")
+		if isClosed(h.ShutdownDoneChan()) {
+			t.Fatal("Shutdown completed while ShutdownWG was held")
+		}
+		wg.Done()
+		awaitShutdownDone(t, h)
+		if _, err := h.ShutdownWGAdd(1); err == nil {
+			t.Fatal("ShutdownWGAdd succeeded after shutdown")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package asyncobjtest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sammck-go/asyncobj"
+)
+
+// TransitionHistory is implemented by objects that record the sequence of states entered by a Helper,
+// such as TransitionRecorder and FakeObject.
+type TransitionHistory interface {
+	// States returns the states entered so far, starting with the state at the time recording began
+	States() []asyncobj.State
+
+	// Changed returns a chan that is closed the next time a state is recorded
+	Changed() <-chan struct{}
+}
+
+// Observable is implemented by objects whose state transitions can be observed, including *asyncobj.Helper
+// and all objects that embed one.
+type Observable interface {
+	GetAsyncObjState() asyncobj.State
+	AddStateObserver(observer asyncobj.StateObserver) (unregister func())
+}
+
+// TransitionRecorder records the states entered by a Helper, using a state observer.
+type TransitionRecorder struct {
+	// lock protects states and changed
+	lock sync.Mutex
+
+	// states is the sequence of states entered
+	states []asyncobj.State
+
+	// changed is closed and replaced each time a state is recorded
+	changed chan struct{}
+}
+
+// RecordTransitions begins recording the states entered by h. The first recorded state is h's state at
+// the time RecordTransitions is called.
+func RecordTransitions(h Observable) *TransitionRecorder {
+	r := &TransitionRecorder{changed: make(chan struct{})}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	h.AddStateObserver(func(oldState asyncobj.State, newState asyncobj.State, info asyncobj.TransitionInfo) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if oldState != r.states[len(r.states)-1] {
+			// A transition that raced with registration, already reflected in the initial state
+			return
+		}
+		r.states = append(r.states, newState)
+		close(r.changed)
+		r.changed = make(chan struct{})
+	})
+	// The observer cannot record anything until the initial state is recorded and the lock is released
+	r.states = append(r.states, h.GetAsyncObjState())
+	return r
+}
+
+// States returns the states entered so far, starting with the state at the time recording began.
+func (r *TransitionRecorder) States() []asyncobj.State {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]asyncobj.State(nil), r.states...)
+}
+
+// Changed returns a chan that is closed the next time a state is recorded.
+func (r *TransitionRecorder) Changed() <-chan struct{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.changed
+}
+
+// AwaitState waits for h to reach state (or any later state), failing the test if it does not do so
+// within timeout.
+func AwaitState(t testing.TB, h Observable, state asyncobj.State, timeout time.Duration) {
+	t.Helper()
+	reached := make(chan struct{})
+	var once sync.Once
+	unregister := h.AddStateObserver(func(oldState asyncobj.State, newState asyncobj.State, info asyncobj.TransitionInfo) {
+		if newState >= state {
+			once.Do(func() {
+				close(reached)
+			})
+		}
+	})
+	defer unregister()
+	if h.GetAsyncObjState() >= state {
+		return
+	}
+	select {
+	case <-reached:
+	case <-time.After(timeout):
+		t.Fatalf("Object did not reach %s within %s; it is in %s", state, timeout, h.GetAsyncObjState())
+	}
+}
+
+// AssertTransitions checks that the states recorded by history are exactly want. Since state observers
+// are notified asynchronously, it waits up to Timeout for the expected number of states to be recorded.
+func AssertTransitions(t testing.TB, history TransitionHistory, want []asyncobj.State) {
+	t.Helper()
+	deadline := time.After(Timeout)
+	for {
+		changed := history.Changed()
+		got := history.States()
+		if len(got) >= len(want) {
+			if !equalStates(got, want) {
+				t.Fatalf("Recorded transitions %v; expected %v", got, want)
+			}
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("Recorded transitions %v within %s; expected %v", got, Timeout, want)
+		}
+	}
+}
+
+// equalStates returns true if a and b contain the same states in the same order
+func equalStates(a []asyncobj.State, b []asyncobj.State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ActivatableChild is a dependent child that can be activated by its parent's Helper. Any object that
+// embeds a *Helper and implements HandleOnceActivator or HandleOnceActivatorContext qualifies.
+type ActivatableChild interface {
+	AsyncShutdowner
+
+	// DoOnceActivateContext activates the child. The parent always passes a nil callback, so the child's
+	// own activation handler is used, and waitOnFail==false.
+	DoOnceActivateContext(ctx context.Context, onceActivateCallback OnceActivateContextCallback, waitOnFail bool) error
+}
+
+// AddActivatableChild adds a dependent child object that can be activated, such as another object that
+// embeds a *Helper. The child is registered as with AddAsyncShutdownChild, so it will be actively shut
+// down after StateLocalShutdown. In addition, DoOnceActivate activates the child, with the parent's
+// activation context, before the parent's own activation callback is called; children are activated one at
+// a time in registration order, or concurrently if SetParallelChildActivation(true) has been called.
+// If activation of any child, or of the parent itself, fails, the children that were already activated are
+// shut down in reverse order, and each is waited for, before the parent's shutdown starts. A child that is
+// detached or removed before activation starts is not activated.
+// On success, a ChildHandle is returned that can be used to unregister the child.
+// An error is returned if activation has already started.
+func (h *Helper) AddActivatableChild(child ActivatableChild) (ChildHandle, error) {
+	h.Lock.Lock()
+	if h.state >= StateActivating {
+		h.Lock.Unlock()
+		return nil, fmt.Errorf("Cannot add activatable child; activation already started: \"%s\"", describeObject(child))
+	}
+	reg := &childRegistration{h: h, doneChan: child.ShutdownDoneChan(), asyncChild: child, activatable: child}
+	h.lockedAddChild(reg)
+	h.activatableChildren = append(h.activatableChildren, reg)
+	h.Lock.Unlock()
+	h.linkChildTrace(child)
+	return reg, nil
+}
+
+// SetParallelChildActivation determines whether children added with AddActivatableChild are activated
+// concurrently (true) or one at a time in registration order (false, the default). When activating
+// concurrently, the context passed to the remaining children is cancelled as soon as one of them fails.
+// Cannot be called after activation has started.
+func (h *Helper) SetParallelChildActivation(enabled bool) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.state >= StateActivating {
+		return errors.New("Cannot SetParallelChildActivation after activation has started")
+	}
+	h.parallelChildActivation = enabled
+	return nil
+}
+
+// activateChildren activates the children added with AddActivatableChild that are still registered, as
+// part of activation of the parent. It returns the children that were successfully activated, in
+// registration order, and the first error encountered. Called in StateActivating, with shutdown deferred.
+func (h *Helper) activateChildren(ctx context.Context, activateSpan Span) ([]*childRegistration, error) {
+	h.Lock.Lock()
+	var children []*childRegistration
+	for _, reg := range h.activatableChildren {
+		// Children that have been detached or removed are no longer our concern
+		if reg.index >= 0 {
+			children = append(children, reg)
+		}
+	}
+	h.activatableChildren = nil
+	parallel := h.parallelChildActivation
+	h.Lock.Unlock()
+
+	if parallel {
+		return h.activateChildrenParallel(ctx, children, activateSpan)
+	}
+
+	activated := make([]*childRegistration, 0, len(children))
+	for _, reg := range children {
+		err := h.activateChild(ctx, reg, activateSpan)
+		if err != nil {
+			return activated, err
+		}
+		activated = append(activated, reg)
+	}
+	return activated, nil
+}
+
+// activateChildrenParallel activates children concurrently, cancelling the activation of the others as
+// soon as one of them fails. It waits for all of them to finish, and returns the children that were
+// successfully activated, in registration order, and the first error encountered.
+func (h *Helper) activateChildrenParallel(
+	ctx context.Context,
+	children []*childRegistration,
+	activateSpan Span,
+) ([]*childRegistration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var errLock sync.Mutex
+	var firstErr error
+	errs := make([]error, len(children))
+	var wg sync.WaitGroup
+	wg.Add(len(children))
+	for i, reg := range children {
+		go func(i int, reg *childRegistration) {
+			defer wg.Done()
+			err := h.activateChild(ctx, reg, activateSpan)
+			if err != nil {
+				errLock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errLock.Unlock()
+				cancel()
+			}
+			errs[i] = err
+		}(i, reg)
+	}
+	wg.Wait()
+
+	activated := make([]*childRegistration, 0, len(children))
+	for i, reg := range children {
+		if errs[i] == nil {
+			activated = append(activated, reg)
+		}
+	}
+	return activated, firstErr
+}
+
+// activateChild activates a single child added with AddActivatableChild, and returns its activation error.
+func (h *Helper) activateChild(ctx context.Context, reg *childRegistration, activateSpan Span) error {
+	child := reg.activatable
+	span := h.startChildOperationSpan(reg, "activate child", activateSpan)
+	err := h.callRecovering("child activation", func() error {
+		return child.DoOnceActivateContext(ctx, nil, false)
+	})
+	if err != nil {
+		h.lg.DLogf("Activation of child \"%s\" failed: %s", reg.describe(), err)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// rollbackChildActivation shuts down children that were activated before activation of the parent failed
+// with err, in the reverse of the order in which they were activated, waiting for each to finish before
+// shutting down the next. err is used as the advisory completion status of each child.
+func (h *Helper) rollbackChildActivation(activated []*childRegistration, err error) {
+	for i := len(activated) - 1; i >= 0; i-- {
+		reg := activated[i]
+		child := reg.activatable
+		h.lg.DLogf("Activation failed; shutting down activated child \"%s\"", reg.describe())
+		panicErr := h.callRecovering("child StartShutdown", func() error {
+			child.StartShutdown(err)
+			return nil
+		})
+		if panicErr != nil {
+			// Don't wait for a child that may never finish
+			continue
+		}
+		child.WaitShutdown()
+	}
+}
@@ -0,0 +1,144 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// activationLog records the activations and shutdowns of a parent and its activatable children
+type activationLog struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (l *activationLog) add(event string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.events = append(l.events, event)
+}
+
+// check fails the test if the log does not contain exactly want
+func (l *activationLog) check(t *testing.T, want ...string) {
+	t.Helper()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if strings.Join(l.events, ",") != strings.Join(want, ",") {
+		t.Fatalf("Events %v; expected %v", l.events, want)
+	}
+}
+
+// activatableObject is an object with its own activation and shutdown handlers, for use as an activatable
+// child. Shutdown is only logged for objects that activate successfully, since an object whose activation
+// fails shuts itself down in the background.
+type activatableObject struct {
+	*Helper
+
+	// name identifies the object in the log
+	name string
+
+	// log records activation and shutdown
+	log *activationLog
+
+	// activate is called to activate the object
+	activate func(ctx context.Context) error
+}
+
+func newActivatableObject(log *activationLog, name string, activate func(ctx context.Context) error) *activatableObject {
+	o := &activatableObject{name: name, log: log, activate: activate}
+	o.Helper = NewHelper(nil, o).(*Helper)
+	return o
+}
+
+func (o *activatableObject) HandleOnceActivateContext(ctx context.Context) error {
+	o.log.add("activate " + o.name)
+	return o.activate(ctx)
+}
+
+func (o *activatableObject) HandleOnceShutdown(completionErr error) error {
+	if o.IsActivated() {
+		o.log.add("stop " + o.name)
+	}
+	return completionErr
+}
+
+// succeed is an activation function that succeeds
+func succeed(ctx context.Context) error {
+	return nil
+}
+
+// newActivationTestParent creates a parent with activatable children named a, b and c, using the given
+// activation functions
+func newActivationTestParent(t *testing.T, log *activationLog, a, b, c func(ctx context.Context) error) *activatableObject {
+	t.Helper()
+	parent := newActivatableObject(log, "parent", succeed)
+	for _, child := range []*activatableObject{
+		newActivatableObject(log, "a", a),
+		newActivatableObject(log, "b", b),
+		newActivatableObject(log, "c", c),
+	} {
+		if _, err := parent.AddActivatableChild(child); err != nil {
+			t.Fatalf("AddActivatableChild failed: %s", err)
+		}
+	}
+	return parent
+}
+
+func TestActivatableChildren(t *testing.T) {
+	log := &activationLog{}
+	parent := newActivationTestParent(t, log, succeed, succeed, succeed)
+	if err := parent.DoOnceActivate(nil, true); err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+	log.check(t, "activate a", "activate b", "activate c", "activate parent")
+	if _, err := parent.AddActivatableChild(newActivatableObject(log, "d", succeed)); err == nil {
+		t.Fatal("AddActivatableChild succeeded after activation")
+	}
+	parent.Close()
+}
+
+func TestActivatableChildFailure(t *testing.T) {
+	childErr := errors.New("child failed")
+	log := &activationLog{}
+	parent := newActivationTestParent(t, log, succeed, func(ctx context.Context) error { return childErr }, succeed)
+	if err := parent.DoOnceActivate(nil, true); err != childErr {
+		t.Fatalf("DoOnceActivate returned %v; expected %v", err, childErr)
+	}
+	// c is never activated, and a is shut down again
+	log.check(t, "activate a", "activate b", "stop a")
+}
+
+func TestActivatableChildrenRollback(t *testing.T) {
+	parentErr := errors.New("parent failed")
+	log := &activationLog{}
+	parent := newActivationTestParent(t, log, succeed, succeed, succeed)
+	parent.activate = func(ctx context.Context) error { return parentErr }
+	if err := parent.DoOnceActivate(nil, true); err != parentErr {
+		t.Fatalf("DoOnceActivate returned %v; expected %v", err, parentErr)
+	}
+	log.check(t, "activate a", "activate b", "activate c", "activate parent", "stop c", "stop b", "stop a")
+}
+
+func TestParallelChildActivation(t *testing.T) {
+	childErr := errors.New("child failed")
+	log := &activationLog{}
+	// a and c only finish activating once b has failed
+	waitForCancel := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	parent := newActivationTestParent(t, log, waitForCancel, func(ctx context.Context) error { return childErr }, waitForCancel)
+	if err := parent.SetParallelChildActivation(true); err != nil {
+		t.Fatalf("SetParallelChildActivation failed: %s", err)
+	}
+	if err := parent.DoOnceActivate(nil, true); err != childErr {
+		t.Fatalf("DoOnceActivate returned %v; expected %v", err, childErr)
+	}
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	if len(log.events) != 3 {
+		t.Fatalf("Events %v; expected only the activation of each child", log.events)
+	}
+}
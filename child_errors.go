@@ -0,0 +1,114 @@
+package asyncobj
+
+import (
+	"errors"
+	"strings"
+)
+
+// ChildErrorPolicy determines how the completion errors of a Helper's children are combined with
+// the local completion status to produce the final completion status returned by WaitShutdown.
+// Children are shut down with the local completion status as their advisory completion status, so a child
+// error that is identical to the local completion status (i.e., a child that simply returned its advisory
+// status) is not considered a child error by any policy.
+type ChildErrorPolicy int
+
+const (
+	// IgnoreChildErrors ignores the completion errors of children. The final completion status is
+	// the same as the local completion status. This is the default.
+	IgnoreChildErrors ChildErrorPolicy = iota
+
+	// JoinChildErrors combines the local completion status and every non-nil child completion error
+	// into a *MultiError. If no child reports an error, the final completion status is the same as the
+	// local completion status.
+	JoinChildErrors
+
+	// FirstChildError uses the local completion status if it is non-nil; otherwise, it uses the
+	// first non-nil child completion error, in completion order.
+	FirstChildError
+)
+
+// MultiError is an error that aggregates several errors, such as the local completion status of a
+// Helper and the completion errors of its children. errors.Is and errors.As succeed if they succeed
+// for any of the aggregated errors.
+type MultiError struct {
+	// Errors is the list of aggregated errors. It contains no nil entries.
+	Errors []error
+}
+
+// Error returns the messages of all aggregated errors, separated by semicolons
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is returns true if any of the aggregated errors matches target
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first aggregated error that matches target, and if one is found, sets target to that
+// error value and returns true
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetChildErrorPolicy determines how the completion errors of children registered with AddAsyncShutdownChild
+// and AddSyncCloseChild are combined with the local completion status to produce the final completion status
+// returned by WaitShutdown. WaitLocalShutdown always returns only the local completion status.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetChildErrorPolicy(policy ChildErrorPolicy) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetChildErrorPolicy after shutdown has started")
+	}
+	h.childErrorPolicy = policy
+	return nil
+}
+
+// addChildError records the non-nil completion error of a child that was shut down by this helper.
+// Errors that are identical to the local completion status (which children receive as their advisory
+// completion status) are not recorded, since they add no information; see ChildErrorPolicy.
+func (h *Helper) addChildError(err error) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.childErrorPolicy != IgnoreChildErrors && err != nil && err != h.shutdownErr {
+		h.childErrs = append(h.childErrs, err)
+	}
+}
+
+// lockedCombineChildErrors computes the final completion status from the local completion status and
+// the recorded child errors, according to the child error policy. The lock must be held when this
+// method is called.
+func (h *Helper) lockedCombineChildErrors() error {
+	if len(h.childErrs) == 0 {
+		return h.shutdownErr
+	}
+	switch h.childErrorPolicy {
+	case JoinChildErrors:
+		errs := make([]error, 0, len(h.childErrs)+1)
+		if h.shutdownErr != nil {
+			errs = append(errs, h.shutdownErr)
+		}
+		return &MultiError{Errors: append(errs, h.childErrs...)}
+	case FirstChildError:
+		if h.shutdownErr != nil {
+			return h.shutdownErr
+		}
+		return h.childErrs[0]
+	}
+	return h.shutdownErr
+}
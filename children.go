@@ -0,0 +1,289 @@
+package asyncobj
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// DefaultChildShutdownParallelism is the default maximum number of io.Closer children that a Helper
+// will close concurrently after StateLocalShutdown.
+const DefaultChildShutdownParallelism = 64
+
+// minChildPruneThreshold is the smallest number of registered children at which a Helper will
+// bother to prune children that have already finished.
+const minChildPruneThreshold = 64
+
+// ChildHandle represents the registration of a dependent child with a Helper, as returned by
+// AddShutdownChildChan, AddAsyncShutdownChild and AddSyncCloseChild. It allows a long-lived parent to
+// forget about children that are no longer relevant (for example, per-connection children of a server
+// whose connections have been closed) so that the resources used to track them are released.
+type ChildHandle interface {
+	// Detach unregisters the child without taking any action on it. The helper will no longer shut down,
+	// close or wait for the child, and the resources used to track it are released immediately.
+	// Returns true if the child was unregistered by this call; false if it had already been detached
+	// or removed, had already finished, or if the helper had already begun shutting it down.
+	Detach() bool
+
+	// Remove unregisters the child as with Detach, and if that succeeds, shuts down or closes the child
+	// synchronously in the calling goroutine and returns its completion status. For a chan added with
+	// AddShutdownChildChan, Remove is the same as Detach. If the child could not be unregistered,
+	// no action is taken and nil is returned.
+	Remove() error
+}
+
+// childRegistration is the Helper's record of a registered dependent child, and its implementation
+// of ChildHandle. Registrations live in the helper's children list until they are detached, pruned
+// because the child finished on its own, or taken by the shutdown goroutine at StateLocalShutdown.
+// No goroutine is associated with a registration until the child is actually shut down.
+type childRegistration struct {
+	// h is the helper with which the child is registered
+	h *Helper
+
+	// doneChan is closed when the child has finished, or is nil for children added with AddSyncCloseChild
+	doneChan <-chan struct{}
+
+	// asyncChild is the child, if it was added with AddAsyncShutdownChild or AddActivatableChild
+	asyncChild AsyncShutdowner
+
+	// activatable is the child, if it was added with AddActivatableChild
+	activatable ActivatableChild
+
+	// closer is the child, if it was added with AddSyncCloseChild
+	closer io.Closer
+
+	// index is the position of this registration in h.children, or -1 if it is no longer in the list.
+	// Protected by h.Lock.
+	index int
+
+	// span is the span opened for the shutdown of the child, if tracing is enabled
+	span Span
+}
+
+// isDone returns true if the child is known to have finished on its own.
+func (reg *childRegistration) isDone() bool {
+	if reg.doneChan == nil {
+		return false
+	}
+	select {
+	case <-reg.doneChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Detach unregisters the child without taking any action on it.
+func (reg *childRegistration) Detach() bool {
+	reg.h.Lock.Lock()
+	defer reg.h.Lock.Unlock()
+	if reg.index < 0 {
+		return false
+	}
+	reg.h.lockedRemoveChild(reg)
+	return true
+}
+
+// Remove unregisters the child and then shuts it down or closes it synchronously.
+func (reg *childRegistration) Remove() error {
+	if !reg.Detach() {
+		return nil
+	}
+	if reg.asyncChild != nil {
+		reg.asyncChild.StartShutdown(nil)
+		return reg.asyncChild.WaitShutdown()
+	}
+	if reg.closer != nil {
+		return reg.closer.Close()
+	}
+	return nil
+}
+
+// SetChildShutdownParallelism limits the number of children added with AddSyncCloseChild that will be
+// closed concurrently after StateLocalShutdown. If n <= 0, there is no limit. The default is
+// DefaultChildShutdownParallelism. Children added with AddAsyncShutdownChild are always asked to
+// shut down all at once, since StartShutdown does not block.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetChildShutdownParallelism(n int) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetChildShutdownParallelism after shutdown has started")
+	}
+	h.childShutdownParallelism = n
+	return nil
+}
+
+// lockedAddChild adds a new registration to the set of children. If the shutdown goroutine has already
+// taken the set of children, the child is shut down immediately in its own goroutine instead, holding
+// off final shutdown until it is done. The lock must be held when this method is called.
+func (h *Helper) lockedAddChild(reg *childRegistration) {
+	h.metricsChildrenChanged(1)
+	if h.state >= StateLocalShutdown {
+		reg.index = -1
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.shutdownChildren([]*childRegistration{reg})
+		}()
+		return
+	}
+	if len(h.children) >= h.childPruneThreshold {
+		h.lockedPruneChildren()
+	}
+	reg.index = len(h.children)
+	h.children = append(h.children, reg)
+}
+
+// lockedRemoveChild removes a registration from the set of children in constant time.
+// The lock must be held when this method is called.
+func (h *Helper) lockedRemoveChild(reg *childRegistration) {
+	last := len(h.children) - 1
+	moved := h.children[last]
+	h.children[reg.index] = moved
+	moved.index = reg.index
+	h.children[last] = nil
+	h.children = h.children[:last]
+	reg.index = -1
+	h.metricsChildrenChanged(-1)
+}
+
+// lockedPruneChildren removes registrations of children that have already finished on their own, and
+// sets the threshold for the next pruning to twice the remaining number of children, so that the
+// cost of pruning is amortized over registrations. The lock must be held when this method is called.
+func (h *Helper) lockedPruneChildren() {
+	for i := 0; i < len(h.children); {
+		reg := h.children[i]
+		if reg.isDone() {
+			h.lockedRemoveChild(reg)
+		} else {
+			i++
+		}
+	}
+	h.childPruneThreshold = 2 * len(h.children)
+	if h.childPruneThreshold < minChildPruneThreshold {
+		h.childPruneThreshold = minChildPruneThreshold
+	}
+}
+
+// lockedTakeChildren removes all registrations from the set of children and returns them. Called by
+// the shutdown goroutine upon entering StateLocalShutdown. The lock must be held when this method is called.
+func (h *Helper) lockedTakeChildren() []*childRegistration {
+	children := h.children
+	h.children = nil
+	for _, reg := range children {
+		reg.index = -1
+	}
+	return children
+}
+
+// shutdownChildren actively shuts down a set of children that have been taken from the children list,
+// and waits for all of them to finish. All asynchronous children are asked to shut down at once. io.Closer
+// children are closed by a pool of at most childShutdownParallelism goroutines. Finally, the calling
+// goroutine waits for each child in turn.
+func (h *Helper) shutdownChildren(children []*childRegistration) {
+	var closers []*childRegistration
+	var waiters []*childRegistration
+	for _, reg := range children {
+		if reg.closer != nil {
+			closers = append(closers, reg)
+		} else if !reg.isDone() {
+			// Children that finished on their own before now are simply forgotten
+			if reg.asyncChild != nil {
+				// h.DLogf("Local shutdown done, shutting down async child \"%s\"", reg.asyncChild)
+				child := reg.asyncChild
+				reg.span = h.startChildSpan(reg)
+				err := h.callRecovering("child StartShutdown", func() error {
+					child.StartShutdown(h.shutdownErr)
+					return nil
+				})
+				if err != nil {
+					// Don't wait for a child that may never finish
+					h.addChildError(err)
+					endSpan(reg.span, err)
+					continue
+				}
+			} else {
+				reg.span = h.startChildSpan(reg)
+			}
+			waiters = append(waiters, reg)
+		}
+	}
+
+	h.Lock.Lock()
+	// Children that finished on their own or could not be shut down are no longer counted
+	h.metricsChildrenChanged(len(closers) + len(waiters) - len(children))
+	if h.pendingChildren == nil {
+		h.pendingChildren = make(map[*childRegistration]struct{})
+	}
+	for _, reg := range closers {
+		h.pendingChildren[reg] = struct{}{}
+	}
+	for _, reg := range waiters {
+		h.pendingChildren[reg] = struct{}{}
+	}
+	h.Lock.Unlock()
+
+	var closersDone sync.WaitGroup
+	if len(closers) > 0 {
+		n := h.childShutdownParallelism
+		if n <= 0 || n > len(closers) {
+			n = len(closers)
+		}
+		work := make(chan *childRegistration, len(closers))
+		for _, reg := range closers {
+			work <- reg
+		}
+		close(work)
+		closersDone.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer closersDone.Done()
+				for reg := range work {
+					reg.span = h.startChildSpan(reg)
+					h.childFinished(reg, h.closeChild(reg.closer))
+				}
+			}()
+		}
+	}
+
+	for _, reg := range waiters {
+		<-reg.doneChan
+		var err error
+		if reg.asyncChild != nil {
+			err = reg.asyncChild.WaitShutdown()
+			if err == nil {
+				// h.DLogf("Shutdown of child done: \"%s\"", reg.asyncChild)
+			} else {
+				// h.DLogf("Shutdown of child done with error: \"%s\": %s", reg.asyncChild, err)
+				h.addChildError(err)
+			}
+		}
+		h.childFinished(reg, err)
+	}
+
+	closersDone.Wait()
+}
+
+// childFinished removes a child that has finished shutting down with completion status err from the set
+// of pending children.
+func (h *Helper) childFinished(reg *childRegistration, err error) {
+	endSpan(reg.span, err)
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	delete(h.pendingChildren, reg)
+	h.metricsChildrenChanged(-1)
+}
+
+// closeChild closes an io.Closer child during shutdown, records its completion error, and returns it.
+func (h *Helper) closeChild(child io.Closer) error {
+	h.lg.TLogf("Local shutdown done, shutting down sync Closer child \"%s\"", child)
+	err := h.callRecovering("child Close", child.Close)
+	if err == nil {
+		h.lg.TLogf("Close of child done: \"%s\"", child)
+	} else {
+		h.lg.TLogf("Close of child done with error: \"%s\": %s", child, err)
+		h.addChildError(err)
+	}
+	return err
+}
@@ -0,0 +1,252 @@
+package asyncobj
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingCloser is an io.Closer that records how many Close calls are in progress at once
+type countingCloser struct {
+	tracker *concurrencyTracker
+	closed  bool
+}
+
+// concurrencyTracker records the maximum number of concurrent operations
+type concurrencyTracker struct {
+	lock    sync.Mutex
+	current int
+	max     int
+}
+
+func (c *countingCloser) Close() error {
+	c.tracker.lock.Lock()
+	c.tracker.current++
+	if c.tracker.current > c.tracker.max {
+		c.tracker.max = c.tracker.current
+	}
+	c.tracker.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.tracker.lock.Lock()
+	c.tracker.current--
+	c.closed = true
+	c.tracker.lock.Unlock()
+	return nil
+}
+
+// newTestHelper creates an unactivated helper with a trivial shutdown handler
+func newTestHelper() *Helper {
+	return NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		return completionErr
+	}).(*Helper)
+}
+
+// checkChildIndexes verifies that every registration in h.children knows its own position
+func checkChildIndexes(t *testing.T, h *Helper) {
+	t.Helper()
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	for i, reg := range h.children {
+		if reg.index != i {
+			t.Fatalf("Registration at position %d has index %d", i, reg.index)
+		}
+	}
+}
+
+func TestChildDetach(t *testing.T) {
+	parent := newTestHelper()
+	child := newTestHelper()
+	handle, err := parent.AddAsyncShutdownChild(child)
+	if err != nil {
+		t.Fatalf("AddAsyncShutdownChild failed: %s", err)
+	}
+	if !handle.Detach() {
+		t.Fatal("Detach returned false for a registered child")
+	}
+	if handle.Detach() {
+		t.Fatal("Second Detach returned true")
+	}
+	if err := parent.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+	if child.IsScheduledShutdown() {
+		t.Fatal("Detached child was shut down with its parent")
+	}
+	child.Close()
+}
+
+func TestChildRemove(t *testing.T) {
+	parent := newTestHelper()
+	childErr := errors.New("child error")
+	child := NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		return childErr
+	})
+	handle, _ := parent.AddAsyncShutdownChild(child)
+	if err := handle.Remove(); err != childErr {
+		t.Fatalf("Remove returned %v; expected %v", err, childErr)
+	}
+	if !child.IsDoneShutdown() {
+		t.Fatal("Remove returned before the child finished shutting down")
+	}
+	if err := handle.Remove(); err != nil {
+		t.Fatalf("Second Remove returned %v", err)
+	}
+
+	closer := &countingCloser{tracker: &concurrencyTracker{}}
+	closerHandle, _ := parent.AddSyncCloseChild(closer)
+	if err := closerHandle.Remove(); err != nil || !closer.closed {
+		t.Fatalf("Remove of an io.Closer child returned %v, closed=%t", err, closer.closed)
+	}
+
+	doneChan := make(chan struct{})
+	chanHandle, _ := parent.AddShutdownChildChan(doneChan)
+	if err := chanHandle.Remove(); err != nil {
+		t.Fatalf("Remove of a chan returned %v", err)
+	}
+	// The chan is never closed, so shutdown would hang if it were still registered
+	if err := parent.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+}
+
+func TestChildSwapRemove(t *testing.T) {
+	parent := newTestHelper()
+	const n = 10
+	handles := make([]ChildHandle, n)
+	doneChans := make([]chan struct{}, n)
+	for i := range handles {
+		doneChans[i] = make(chan struct{})
+		handles[i], _ = parent.AddShutdownChildChan(doneChans[i])
+	}
+	// Remove from the middle, the front and the end
+	for _, i := range []int{4, 0, n - 1, 5} {
+		if !handles[i].Detach() {
+			t.Fatalf("Detach of child %d failed", i)
+		}
+		checkChildIndexes(t, parent)
+	}
+	parent.Lock.Lock()
+	remaining := len(parent.children)
+	parent.Lock.Unlock()
+	if remaining != n-4 {
+		t.Fatalf("%d children remain; expected %d", remaining, n-4)
+	}
+	for _, i := range []int{1, 2, 3, 6, 7, 8} {
+		if !handles[i].Detach() {
+			t.Fatalf("Detach of remaining child %d failed", i)
+		}
+		checkChildIndexes(t, parent)
+	}
+	if err := parent.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+}
+
+func TestChildPruning(t *testing.T) {
+	parent := newTestHelper()
+	doneChan := make(chan struct{})
+	close(doneChan)
+	for i := 0; i < minChildPruneThreshold; i++ {
+		parent.AddShutdownChildChan(doneChan)
+	}
+	liveChan := make(chan struct{})
+	parent.AddShutdownChildChan(liveChan)
+
+	parent.Lock.Lock()
+	remaining := len(parent.children)
+	threshold := parent.childPruneThreshold
+	parent.Lock.Unlock()
+	if remaining != 1 {
+		t.Fatalf("%d children remain after pruning; expected 1", remaining)
+	}
+	if threshold != minChildPruneThreshold {
+		t.Fatalf("Prune threshold is %d; expected %d", threshold, minChildPruneThreshold)
+	}
+	checkChildIndexes(t, parent)
+
+	close(liveChan)
+	if err := parent.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+}
+
+func TestChildShutdownParallelism(t *testing.T) {
+	parent := newTestHelper()
+	if err := parent.SetChildShutdownParallelism(2); err != nil {
+		t.Fatalf("SetChildShutdownParallelism failed: %s", err)
+	}
+	tracker := &concurrencyTracker{}
+	closers := make([]*countingCloser, 8)
+	for i := range closers {
+		closers[i] = &countingCloser{tracker: tracker}
+		parent.AddSyncCloseChild(closers[i])
+	}
+	if err := parent.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if tracker.max > 2 {
+		t.Fatalf("%d children were closed concurrently; limit was 2", tracker.max)
+	}
+	for i, c := range closers {
+		if !c.closed {
+			t.Fatalf("Child %d was not closed", i)
+		}
+	}
+	if err := parent.SetChildShutdownParallelism(4); err == nil {
+		t.Fatal("SetChildShutdownParallelism succeeded after shutdown")
+	}
+}
+
+func TestChildErrorPolicy(t *testing.T) {
+	localErr := errors.New("local error")
+	childErr := errors.New("child error")
+	newParent := func(policy ChildErrorPolicy) *Helper {
+		parent := newTestHelper()
+		if err := parent.SetChildErrorPolicy(policy); err != nil {
+			t.Fatalf("SetChildErrorPolicy failed: %s", err)
+		}
+		// One child fails, and one simply returns the advisory completion status it was given
+		parent.AddAsyncShutdownChild(NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+			return childErr
+		}))
+		parent.AddAsyncShutdownChild(newTestHelper())
+		return parent
+	}
+
+	parent := newParent(JoinChildErrors)
+	err := parent.Shutdown(localErr)
+	multiErr, ok := err.(*MultiError)
+	if !ok {
+		t.Fatalf("Shutdown returned %v; expected a *MultiError", err)
+	}
+	if len(multiErr.Errors) != 2 || multiErr.Errors[0] != localErr || multiErr.Errors[1] != childErr {
+		t.Fatalf("Unexpected aggregated errors %v", multiErr.Errors)
+	}
+	if !errors.Is(err, localErr) || !errors.Is(err, childErr) {
+		t.Fatalf("MultiError %v does not match the aggregated errors", err)
+	}
+	if msg := err.Error(); msg != "local error; child error" {
+		t.Fatalf("Unexpected error message %q", msg)
+	}
+	if err := parent.WaitLocalShutdown(); err != localErr {
+		t.Fatalf("WaitLocalShutdown returned %v; expected %v", err, localErr)
+	}
+
+	parent = newParent(FirstChildError)
+	if err := parent.Shutdown(nil); err != childErr {
+		t.Fatalf("Shutdown returned %v; expected %v", err, childErr)
+	}
+
+	parent = newParent(IgnoreChildErrors)
+	if err := parent.Shutdown(localErr); err != localErr {
+		t.Fatalf("Shutdown returned %v; expected %v", err, localErr)
+	}
+	if err := parent.SetChildErrorPolicy(JoinChildErrors); err == nil {
+		t.Fatal("SetChildErrorPolicy succeeded after shutdown")
+	}
+}
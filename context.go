@@ -0,0 +1,142 @@
+package asyncobj
+
+import (
+	"context"
+	"time"
+)
+
+// ShutdownContextError is the Err() of a context returned by Helper.Context or ContextFromShutdowner once
+// the object has begun shutting down. errors.Is(err, context.Canceled) is true, and the error unwraps to
+// the object's advisory (or, for ContextFromShutdowner, possibly final) completion status, so that it can
+// be recovered with errors.Is, errors.As, or context.Cause.
+type ShutdownContextError struct {
+	// Cause is the completion status of the object, which may be nil
+	Cause error
+}
+
+// Error returns a description of the shutdown
+func (e *ShutdownContextError) Error() string {
+	if e.Cause == nil {
+		return "Object shut down"
+	}
+	return "Object shut down: " + e.Cause.Error()
+}
+
+// Unwrap returns the completion status of the object
+func (e *ShutdownContextError) Unwrap() error {
+	return e.Cause
+}
+
+// Is returns true if target is context.Canceled, so that code that checks for context cancellation
+// treats shutdown of the object as cancellation.
+func (e *ShutdownContextError) Is(target error) bool {
+	return target == context.Canceled
+}
+
+// helperContext is the context.Context returned by Helper.Context. It is done when the helper
+// enters StateShuttingDown.
+type helperContext struct {
+	h *Helper
+
+	// err is created when first needed after the context is done. Protected by h.Lock.
+	err error
+}
+
+// Deadline returns ok==false; the lifetime of an object has no deadline
+func (c *helperContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+// Done returns the helper's ShutdownStartedChan
+func (c *helperContext) Done() <-chan struct{} {
+	return c.h.shutdownStartedChan
+}
+
+// Err returns nil until the helper enters StateShuttingDown, then a *ShutdownContextError wrapping
+// the advisory completion status
+func (c *helperContext) Err() error {
+	select {
+	case <-c.h.shutdownStartedChan:
+	default:
+		return nil
+	}
+	c.h.Lock.Lock()
+	defer c.h.Lock.Unlock()
+	if c.err == nil {
+		c.err = &ShutdownContextError{Cause: c.h.advisoryShutdownErr}
+	}
+	return c.err
+}
+
+// Value returns nil; the context carries no values
+func (c *helperContext) Value(key interface{}) interface{} {
+	return nil
+}
+
+// String returns a description of the context
+func (c *helperContext) String() string {
+	return "asyncobj.Helper.Context"
+}
+
+// Context returns a context.Context view of the lifetime of the helper, for bridging into context-based
+// APIs. Its Done() chan is ShutdownStartedChan(). Once it is done, its Err() is a *ShutdownContextError,
+// which matches context.Canceled with errors.Is, and unwraps to the advisory completion status passed to
+// the first call to StartShutdown. The same context is returned on every call, and no goroutine is
+// required to maintain it.
+func (h *Helper) Context() context.Context {
+	return h.lifetimeCtx
+}
+
+// contexter is implemented by objects that can provide a context.Context view of their own lifetime,
+// such as Helper.
+type contexter interface {
+	Context() context.Context
+}
+
+// shutdownerContext is the context.Context returned by ContextFromShutdowner for objects that cannot
+// provide their own. It is done when the object has completely shut down.
+type shutdownerContext struct {
+	s AsyncShutdowner
+}
+
+// Deadline returns ok==false; the lifetime of an object has no deadline
+func (c *shutdownerContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+// Done returns the object's ShutdownDoneChan
+func (c *shutdownerContext) Done() <-chan struct{} {
+	return c.s.ShutdownDoneChan()
+}
+
+// Err returns nil until the object has shut down, then a *ShutdownContextError wrapping its final
+// completion status
+func (c *shutdownerContext) Err() error {
+	select {
+	case <-c.s.ShutdownDoneChan():
+		return &ShutdownContextError{Cause: c.s.WaitShutdown()}
+	default:
+		return nil
+	}
+}
+
+// Value returns nil; the context carries no values
+func (c *shutdownerContext) Value(key interface{}) interface{} {
+	return nil
+}
+
+// String returns a description of the context
+func (c *shutdownerContext) String() string {
+	return "asyncobj.ContextFromShutdowner"
+}
+
+// ContextFromShutdowner returns a context.Context view of the lifetime of an arbitrary AsyncShutdowner.
+// If the object provides its own Context() method (as Helper does), that is used. Otherwise, the returned
+// context is done when the object's ShutdownDoneChan() is closed, and its Err() is a *ShutdownContextError
+// wrapping the object's final completion status. No goroutine is required to maintain the context.
+func ContextFromShutdowner(s AsyncShutdowner) context.Context {
+	if c, ok := s.(contexter); ok {
+		return c.Context()
+	}
+	return &shutdownerContext{s: s}
+}
@@ -0,0 +1,59 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// plainShutdowner hides all but the AsyncShutdowner methods of an object
+type plainShutdowner struct {
+	AsyncShutdowner
+}
+
+func TestHelperContext(t *testing.T) {
+	h := newTestHelper()
+	ctx := h.Context()
+	if ctx != h.Context() || ContextFromShutdowner(h) != ctx {
+		t.Fatal("Context returned different contexts for the same helper")
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Context is done before shutdown: %s", err)
+	}
+
+	shutdownErr := errors.New("shutdown error")
+	h.StartShutdown(shutdownErr)
+	<-ctx.Done()
+	err := ctx.Err()
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, shutdownErr) {
+		t.Fatalf("Context ended with %v; expected cancellation with %v", err, shutdownErr)
+	}
+	if ctx.Err() != err {
+		t.Fatal("Context returned different errors from successive calls to Err")
+	}
+	h.WaitShutdown()
+}
+
+func TestContextFromShutdowner(t *testing.T) {
+	h := NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		return errors.New("final error")
+	})
+	ctx := ContextFromShutdowner(plainShutdowner{h})
+	if ctx == h.(*Helper).Context() {
+		t.Fatal("ContextFromShutdowner used the Context method of a hidden Helper")
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Context is done before shutdown: %s", err)
+	}
+
+	h.StartShutdown(errors.New("advisory error"))
+	<-ctx.Done()
+	var shutdownErr *ShutdownContextError
+	if err := ctx.Err(); !errors.As(err, &shutdownErr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Context ended with %v; expected a *ShutdownContextError", err)
+	}
+	// The context is only done once the object has completely shut down, so it carries the final status
+	if shutdownErr.Cause == nil || shutdownErr.Cause.Error() != "final error" {
+		t.Fatalf("Context ended with cause %v; expected the final completion status", shutdownErr.Cause)
+	}
+}
@@ -0,0 +1,175 @@
+package asyncobj
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDraining is returned by Enter once shutdown has been scheduled.
+var ErrDraining = errors.New("Object is draining; no new operations may start")
+
+// OperationToken represents an in-flight operation started with Enter. Exit must be called exactly once
+// when the operation is finished; additional calls have no effect.
+type OperationToken struct {
+	// h is the helper that issued the token
+	h *Helper
+
+	// once ensures that the operation is counted as finished only once
+	once sync.Once
+}
+
+// Exit marks the operation as finished. If the object is draining and this was the last in-flight
+// operation, shutdown proceeds to StateShuttingDown.
+func (t *OperationToken) Exit() {
+	t.once.Do(t.h.exitOperation)
+}
+
+// Enter registers the start of an operation, such as the handling of a request, that should be allowed to
+// finish before the shutdown handler runs. The returned token's Exit method must be called when the
+// operation is finished. ErrDraining is returned, and no operation is registered, once shutdown has been
+// scheduled.
+//
+// The first call to Enter (or to SetDrainTimeout) enables draining: when shutdown starts, the object enters
+// StateDraining, and stays there until all operations have exited or the drain timeout expires, before
+// entering StateShuttingDown and running the shutdown handler. Objects that never call either method go
+// directly to StateShuttingDown. Unlike DeferShutdown, Enter never delays the scheduling of shutdown, and
+// in-flight operations never prevent shutdown once the drain timeout has expired.
+func (h *Helper) Enter() (*OperationToken, error) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.isScheduledShutdown || h.lockedIsStartedShutdown() {
+		return nil, ErrDraining
+	}
+	h.drainEnabled = true
+	h.inFlightOperations++
+	return &OperationToken{h: h}, nil
+}
+
+// exitOperation counts an operation as finished, and ends draining if it was the last one.
+func (h *Helper) exitOperation() {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	h.inFlightOperations--
+	if h.inFlightOperations == 0 && h.state == StateDraining && !h.isDrained {
+		h.isDrained = true
+		close(h.drainedChan)
+	}
+}
+
+// lockedForceDrain ends draining without waiting for in-flight operations. If draining has not yet begun,
+// it will end as soon as it begins. The lock must be held when this method is called.
+func (h *Helper) lockedForceDrain() {
+	if h.isForcedDrain {
+		return
+	}
+	h.isForcedDrain = true
+	if h.state == StateDraining && !h.isDrained {
+		h.isDrained = true
+		close(h.drainedChan)
+	}
+}
+
+// SetDrainTimeout enables draining (see Enter), and limits the time that will be spent in StateDraining
+// waiting for in-flight operations to exit. When it expires, the shutdown handler runs regardless. If
+// timeout is <= 0, there is no limit, which is the default.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetDrainTimeout(timeout time.Duration) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetDrainTimeout after shutdown has started")
+	}
+	h.drainEnabled = true
+	h.drainTimeout = timeout
+	return nil
+}
+
+// DrainingChan returns a chan that is closed as soon as shutdown is scheduled, even if shutdown is
+// deferred. Accept loops and similar producers of new work should stop taking new work when it is closed;
+// Enter fails with ErrDraining from that point on.
+func (h *Helper) DrainingChan() <-chan struct{} {
+	return h.drainingChan
+}
+
+// lockedBeginShutdown is the common code used by StartShutdown and UndeferShutdown to leave the active
+// states once shutdown is scheduled and no longer deferred. It enters StateDraining if draining is enabled,
+// or StateShuttingDown otherwise. asyncDoBeganShutdown must be called after the lock is released.
+// The lock must be held when this method is called.
+func (h *Helper) lockedBeginShutdown() {
+	if !h.drainEnabled {
+		h.lockedEnterShuttingDownState()
+		return
+	}
+	oldState := h.state
+	h.lockedSetState(StateDraining, h.shutdownErr)
+	h.lockedSetShutdownPhase(phaseDraining)
+	h.drainSpan = h.lockedStartSpan("drain", nil)
+	h.currentSpan = h.drainSpan
+	if oldState < StateActivated {
+		h.lockedCloseActivatingDoneChan()
+	}
+	h.drainedChan = make(chan struct{})
+	if h.inFlightOperations == 0 || h.isForcedDrain {
+		h.isDrained = true
+		close(h.drainedChan)
+	}
+}
+
+// asyncDoBeganShutdown starts background processing of shutdown after lockedBeginShutdown, including the
+// watchdog if it is enabled. If the object is draining, it waits in the background for draining to finish
+// before entering StateShuttingDown.
+func (h *Helper) asyncDoBeganShutdown() {
+	if h.watchdogThreshold > 0 {
+		go h.runShutdownWatchdog()
+	}
+	h.Lock.Lock()
+	draining := h.state == StateDraining
+	h.Lock.Unlock()
+	if !draining {
+		h.asyncDoStartedShutdown()
+		return
+	}
+	go h.runDrain()
+}
+
+// runDrain waits for in-flight operations to exit, or for the drain timeout to expire, and then enters
+// StateShuttingDown and continues shutdown.
+func (h *Helper) runDrain() {
+	h.Lock.Lock()
+	drainedChan := h.drainedChan
+	timeout := h.drainTimeout
+	h.Lock.Unlock()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	var drainErr error
+	select {
+	case <-drainedChan:
+		h.Lock.Lock()
+		n := h.inFlightOperations
+		forced := h.isForcedDrain
+		h.Lock.Unlock()
+		if forced && n > 0 {
+			h.lg.WLogf("Draining cut short with %d operations in flight; shutting down anyway", n)
+			drainErr = errors.New("Draining cut short")
+		}
+	case <-timeoutChan:
+		h.Lock.Lock()
+		n := h.inFlightOperations
+		h.Lock.Unlock()
+		h.lg.WLogf("Drain timeout of %s expired with %d operations in flight; shutting down anyway", timeout, n)
+		drainErr = errors.New("Drain timeout expired")
+	}
+
+	h.Lock.Lock()
+	endSpan(h.drainSpan, drainErr)
+	h.lockedEnterShuttingDownState()
+	h.Lock.Unlock()
+	h.dispatchStateTransitions()
+	h.asyncDoStartedShutdown()
+}
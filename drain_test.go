@@ -0,0 +1,92 @@
+package asyncobj
+
+import (
+	"testing"
+	"time"
+)
+
+// newDrainTestHelper creates an unactivated helper whose shutdown handler closes the returned chan
+func newDrainTestHelper() (*Helper, <-chan struct{}) {
+	handlerCalled := make(chan struct{})
+	h := NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		close(handlerCalled)
+		return completionErr
+	}).(*Helper)
+	return h, handlerCalled
+}
+
+// checkDraining fails the test if h is not still draining
+func checkDraining(t *testing.T, h *Helper, handlerCalled <-chan struct{}) {
+	t.Helper()
+	if state := h.GetAsyncObjState(); state != StateDraining {
+		t.Fatalf("State is %s; expected StateDraining", state)
+	}
+	select {
+	case <-handlerCalled:
+		t.Fatal("Shutdown handler was called while operations were in flight")
+	default:
+	}
+}
+
+func TestDrainWaitsForOperations(t *testing.T) {
+	h, handlerCalled := newDrainTestHelper()
+	first, err := h.Enter()
+	if err != nil {
+		t.Fatalf("Enter failed: %s", err)
+	}
+	second, _ := h.Enter()
+	h.StartShutdown(nil)
+	if _, err := h.Enter(); err != ErrDraining {
+		t.Fatalf("Enter returned %v while draining; expected ErrDraining", err)
+	}
+	checkDraining(t, h, handlerCalled)
+
+	first.Exit()
+	// Additional calls to Exit must not count as other operations exiting
+	first.Exit()
+	checkDraining(t, h, handlerCalled)
+
+	second.Exit()
+	if err := h.WaitShutdown(); err != nil {
+		t.Fatalf("WaitShutdown returned %s", err)
+	}
+	<-handlerCalled
+	if _, err := h.Enter(); err != ErrDraining {
+		t.Fatalf("Enter returned %v after shutdown; expected ErrDraining", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	h, handlerCalled := newDrainTestHelper()
+	if err := h.SetDrainTimeout(time.Nanosecond); err != nil {
+		t.Fatalf("SetDrainTimeout failed: %s", err)
+	}
+	token, _ := h.Enter()
+	h.StartShutdown(nil)
+	// The operation never exits before shutdown is complete
+	if err := h.WaitShutdown(); err != nil {
+		t.Fatalf("WaitShutdown returned %s", err)
+	}
+	<-handlerCalled
+	token.Exit()
+	if err := h.SetDrainTimeout(time.Nanosecond); err == nil {
+		t.Fatal("SetDrainTimeout succeeded after shutdown")
+	}
+}
+
+func TestDrainForcedBySignal(t *testing.T) {
+	h, handlerCalled := newDrainTestHelper()
+	token, _ := h.Enter()
+	h.ShutdownOnSignals(testSignal)
+
+	raiseSignal(t, testSignal)
+	<-h.DrainingChan()
+	checkDraining(t, h, handlerCalled)
+	// A second request to shut down cuts draining short
+	raiseSignal(t, testSignal)
+	if err := h.WaitShutdown(); err == nil {
+		t.Fatal("WaitShutdown returned nil; expected a *SignalError")
+	}
+	<-handlerCalled
+	token.Exit()
+}
@@ -1,5 +1,5 @@
 module github.com/sammck-go/asyncobj
 
-go 1.16
+go 1.18
 
 require github.com/sammck-go/logger v1.1.1
@@ -0,0 +1,78 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Go runs fn in a new goroutine whose lifetime is tied to the helper, replacing the common pattern of
+// calling ShutdownWGAdd(1) and then selecting on ShutdownStartedChan in a hand-rolled goroutine.
+//
+// The context passed to fn is cancelled when StateShuttingDown is entered; fn should return promptly
+// when that happens. Final shutdown (StateShutDown) is held off until fn returns. If fn returns a non-nil
+// error, it is logged, and if SetShutdownOnGoError(true) has been called, shutdown of the object is started
+// with that error as the advisory completion status.
+//
+// name identifies the goroutine in diagnostics such as RunningGoroutines; names need not be unique.
+// An error is returned and fn is not run if StateShutDown has already been entered.
+func (h *Helper) Go(name string, fn func(ctx context.Context) error) error {
+	h.Lock.Lock()
+	if h.state >= StateShutDown {
+		h.Lock.Unlock()
+		return errors.New("Cannot start goroutine after StateShutdown")
+	}
+	if h.runningGoroutines == nil {
+		h.runningGoroutines = make(map[string]int)
+	}
+	h.runningGoroutines[name]++
+	h.wg.Add(1)
+	h.Lock.Unlock()
+
+	go func() {
+		defer h.wg.Done()
+		err := h.callRecovering(fmt.Sprintf("goroutine \"%s\"", name), func() error {
+			return fn(h.Context())
+		})
+		h.Lock.Lock()
+		h.runningGoroutines[name]--
+		if h.runningGoroutines[name] == 0 {
+			delete(h.runningGoroutines, name)
+		}
+		shutdownOnErr := h.shutdownOnGoError
+		h.Lock.Unlock()
+		if err != nil {
+			h.lg.DLogf("Goroutine \"%s\" returned error: %s", name, err)
+			var panicErr *PanicError
+			if shutdownOnErr || errors.As(err, &panicErr) {
+				h.StartShutdown(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// SetShutdownOnGoError determines whether a non-nil error returned by a function run with Go starts
+// shutdown of the object with that error as the advisory completion status (errgroup semantics).
+// A recovered panic (see SetRecoverPanics) always starts shutdown. It is disabled by default.
+func (h *Helper) SetShutdownOnGoError(enabled bool) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	h.shutdownOnGoError = enabled
+}
+
+// RunningGoroutines returns the names of goroutines started with Go that have not yet returned,
+// sorted. A name appears once for each such goroutine.
+func (h *Helper) RunningGoroutines() []string {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	var names []string
+	for name, n := range h.runningGoroutines {
+		for i := 0; i < n; i++ {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
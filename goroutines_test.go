@@ -0,0 +1,66 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGoCancelledOnShutdown(t *testing.T) {
+	h := newTestHelper()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var ctxErr error
+	if err := h.Go("worker", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		ctxErr = ctx.Err()
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("Go failed: %s", err)
+	}
+	<-started
+	if names := h.RunningGoroutines(); strings.Join(names, ",") != "worker" {
+		t.Fatalf("RunningGoroutines returned %v; expected [worker]", names)
+	}
+
+	shutdownErr := errors.New("shutdown error")
+	if err := h.LocalShutdown(shutdownErr); err != shutdownErr {
+		t.Fatalf("LocalShutdown returned %v; expected %v", err, shutdownErr)
+	}
+	// The goroutine is still running, so final shutdown must wait for it
+	if h.IsDoneShutdown() {
+		t.Fatal("Shutdown finished while a goroutine started with Go was still running")
+	}
+	close(release)
+	if err := h.WaitShutdown(); err != shutdownErr {
+		t.Fatalf("WaitShutdown returned %v; expected %v", err, shutdownErr)
+	}
+	if !errors.Is(ctxErr, context.Canceled) || !errors.Is(ctxErr, shutdownErr) {
+		t.Fatalf("Goroutine's context ended with %v; expected cancellation with %v", ctxErr, shutdownErr)
+	}
+	if names := h.RunningGoroutines(); len(names) != 0 {
+		t.Fatalf("RunningGoroutines returned %v after shutdown", names)
+	}
+	if err := h.Go("late", func(ctx context.Context) error { return nil }); err == nil {
+		t.Fatal("Go succeeded after shutdown")
+	}
+}
+
+func TestGoErrorStartsShutdown(t *testing.T) {
+	goErr := errors.New("goroutine failed")
+
+	h := newTestHelper()
+	h.SetShutdownOnGoError(true)
+	h.Go("waiting", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	h.Go("failing", func(ctx context.Context) error { return goErr })
+	// The "waiting" goroutine only returns once the error has started shutdown
+	if err := h.WaitShutdown(); err != goErr {
+		t.Fatalf("WaitShutdown returned %v; expected %v", err, goErr)
+	}
+}
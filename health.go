@@ -0,0 +1,322 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Health is the coarse health of an object, as reported by a HealthChecker. Higher values are worse,
+// so the health of a tree of objects is the maximum of the health of its members.
+type Health int
+
+const (
+	// Healthy indicates that the object is working normally
+	Healthy Health = iota
+
+	// Degraded indicates that the object is working, but with reduced capacity or functionality
+	Degraded
+
+	// Unhealthy indicates that the object is not able to do its job
+	Unhealthy
+)
+
+// String returns a human-readable name for a Health
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "Healthy"
+	case Degraded:
+		return "Degraded"
+	case Unhealthy:
+		return "Unhealthy"
+	}
+	return fmt.Sprintf("Health(%d)", int(h))
+}
+
+// HealthStatus is the result of a health check.
+type HealthStatus struct {
+	// Health is the coarse health of the object
+	Health Health
+
+	// Detail is an optional human-readable explanation, typically empty if the object is Healthy
+	Detail string
+}
+
+// String returns a description of the status
+func (s HealthStatus) String() string {
+	if s.Detail == "" {
+		return s.Health.String()
+	}
+	return fmt.Sprintf("%s: %s", s.Health, s.Detail)
+}
+
+// HealthChecker may be attached to a Helper with SetHealthChecker to report the health of the object
+// while it is activated.
+type HealthChecker interface {
+	// Check returns the current health of the object. It may be called concurrently from multiple
+	// goroutines, and should return promptly when ctx is done.
+	Check(ctx context.Context) HealthStatus
+}
+
+// HealthCheckerFunc is an adapter that allows an ordinary function to be used as a HealthChecker
+type HealthCheckerFunc func(ctx context.Context) HealthStatus
+
+// Check calls f(ctx)
+func (f HealthCheckerFunc) Check(ctx context.Context) HealthStatus {
+	return f(ctx)
+}
+
+// HealthReport is the composite health of an object and its registered children, as returned by
+// CheckHealth.
+type HealthReport struct {
+	// Name is the name of the object (see AsyncObjName)
+	Name string
+
+	// HasState is true if the object is managed by a Helper, in which case State is valid
+	HasState bool
+
+	// State is the state of the object at the time of the check
+	State State
+
+	// Status is the health of the object itself
+	Status HealthStatus
+
+	// Health is the worst health of the object and all of its descendants
+	Health Health
+
+	// Children contains the reports of the object's registered children that can report their health
+	Children []HealthReport
+}
+
+// String returns a multi-line, indented description of the report
+func (r HealthReport) String() string {
+	var b strings.Builder
+	r.write(&b, "")
+	return b.String()
+}
+
+// write appends the description of the report to b, with each line prefixed by indent
+func (r HealthReport) write(b *strings.Builder, indent string) {
+	b.WriteString(indent)
+	b.WriteString(r.Name)
+	if r.HasState {
+		fmt.Fprintf(b, " [%s]", r.State)
+	}
+	fmt.Fprintf(b, " %s", r.Status)
+	if r.Health != r.Status.Health {
+		fmt.Fprintf(b, " (subtree %s)", r.Health)
+	}
+	b.WriteString("\n")
+	for _, child := range r.Children {
+		child.write(b, indent+"  ")
+	}
+}
+
+// healthReporter is implemented by objects that can report the health of their own subtree, including
+// *Helper and all objects that embed one.
+type healthReporter interface {
+	CheckHealth(ctx context.Context) HealthReport
+}
+
+// UnhealthyError is the advisory completion status used when shutdown is started by the policy set with
+// SetUnhealthyShutdown.
+type UnhealthyError struct {
+	// Status is the last health status reported before shutdown was started
+	Status HealthStatus
+
+	// Duration is how long the object had been continuously Unhealthy
+	Duration time.Duration
+}
+
+// Error returns a description of the health status
+func (e *UnhealthyError) Error() string {
+	return fmt.Sprintf("Unhealthy for %s: %s", e.Duration, e.Status)
+}
+
+// SetHealthChecker attaches a HealthChecker that reports the health of the object while it is activated.
+// If checker is nil, an activated object is always considered Healthy.
+func (h *Helper) SetHealthChecker(checker HealthChecker) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	h.healthChecker = checker
+}
+
+// checkOwnHealth returns the health of the object itself, without its children. An object that has not
+// yet been activated, or is suspended, is Degraded, and an object that is draining or shutting down is
+// Unhealthy; otherwise the HealthChecker, if any, is consulted. A panic in the HealthChecker is reported as Unhealthy.
+func (h *Helper) checkOwnHealth(ctx context.Context) (State, HealthStatus) {
+	h.Lock.Lock()
+	state := h.state
+	checker := h.healthChecker
+	h.Lock.Unlock()
+
+	if state == StateDraining {
+		return state, HealthStatus{Health: Unhealthy, Detail: "Draining"}
+	}
+	if state >= StateShuttingDown {
+		return state, HealthStatus{Health: Unhealthy, Detail: "Shutting down"}
+	}
+	if state < StateActivated {
+		return state, HealthStatus{Health: Degraded, Detail: "Not yet activated"}
+	}
+	if state != StateActivated {
+		return state, HealthStatus{Health: Degraded, Detail: "Suspended"}
+	}
+	if checker == nil {
+		return state, HealthStatus{Health: Healthy}
+	}
+	var status HealthStatus
+	err := h.callRecovering("health check", func() error {
+		status = checker.Check(ctx)
+		return nil
+	})
+	if err != nil {
+		status = HealthStatus{Health: Unhealthy, Detail: err.Error()}
+	}
+	return state, status
+}
+
+// CheckHealth checks the health of the object and of its registered children that have not yet finished,
+// and returns a composite report. Children that embed a *Helper are checked recursively; other
+// children are included only if they implement HealthChecker. Children are checked one at a time, so ctx
+// should be used to bound the time taken by slow checks. If panic recovery is enabled (see SetRecoverPanics),
+// a child whose check panics is reported as Unhealthy and the remaining children are still checked.
+func (h *Helper) CheckHealth(ctx context.Context) HealthReport {
+	state, status := h.checkOwnHealth(ctx)
+	report := HealthReport{
+		Name:     h.AsyncObjName(),
+		HasState: true,
+		State:    state,
+		Status:   status,
+		Health:   status.Health,
+	}
+
+	h.Lock.Lock()
+	children := make([]*childRegistration, 0, len(h.children)+len(h.pendingChildren))
+	children = append(children, h.children...)
+	for reg := range h.pendingChildren {
+		children = append(children, reg)
+	}
+	h.Lock.Unlock()
+
+	// Children are checked without holding the lock, since they may have to lock themselves
+	for _, reg := range children {
+		if reg.isDone() {
+			continue
+		}
+		var child interface{} = reg.asyncChild
+		if child == nil {
+			child = reg.closer
+		}
+		var childReport HealthReport
+		reporter, isReporter := child.(healthReporter)
+		checker, isChecker := child.(HealthChecker)
+		if !isReporter && !isChecker {
+			continue
+		}
+		// A panicking child is reported as unhealthy rather than abandoning the whole check
+		err := h.callRecovering("child health check", func() error {
+			if isReporter {
+				childReport = reporter.CheckHealth(ctx)
+			} else {
+				childStatus := checker.Check(ctx)
+				childReport = HealthReport{Name: reg.describe(), Status: childStatus, Health: childStatus.Health}
+			}
+			return nil
+		})
+		if err != nil {
+			childStatus := HealthStatus{Health: Unhealthy, Detail: err.Error()}
+			childReport = HealthReport{Name: reg.describe(), Status: childStatus, Health: childStatus.Health}
+		}
+		if childReport.Health > report.Health {
+			report.Health = childReport.Health
+		}
+		report.Children = append(report.Children, childReport)
+	}
+	return report
+}
+
+// SetUnhealthyShutdown enables a policy that starts shutdown of the object, with an *UnhealthyError as the
+// advisory completion status, if its own HealthChecker (see SetHealthChecker) reports Unhealthy continuously
+// for at least threshold. Once the object is activated, its health is checked every interval by a goroutine
+// started with Go. The health of children is not considered; children may have policies of their own.
+// A threshold <= 0 disables the policy, which is the default.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetUnhealthyShutdown(interval time.Duration, threshold time.Duration) error {
+	if threshold > 0 && interval <= 0 {
+		return errors.New("SetUnhealthyShutdown requires a positive interval")
+	}
+	h.Lock.Lock()
+	if h.lockedIsStartedShutdown() {
+		h.Lock.Unlock()
+		return errors.New("Cannot SetUnhealthyShutdown after shutdown has started")
+	}
+	h.unhealthyCheckInterval = interval
+	h.unhealthyShutdownThreshold = threshold
+	start := threshold > 0 && !h.unhealthyShutdownStarted
+	if start {
+		h.unhealthyShutdownStarted = true
+	}
+	h.Lock.Unlock()
+
+	if start {
+		return h.Go("unhealthy shutdown policy", h.runUnhealthyShutdown)
+	}
+	return nil
+}
+
+// runUnhealthyShutdown is the body of the goroutine that enforces the policy set with SetUnhealthyShutdown.
+// ctx is cancelled when shutdown starts.
+func (h *Helper) runUnhealthyShutdown(ctx context.Context) error {
+	select {
+	case <-h.activatingDoneChan:
+	case <-ctx.Done():
+		return nil
+	}
+
+	var unhealthySince time.Time
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		h.Lock.Lock()
+		interval := h.unhealthyCheckInterval
+		threshold := h.unhealthyShutdownThreshold
+		if threshold <= 0 {
+			// The policy has been disabled; a later SetUnhealthyShutdown will start a new goroutine
+			h.unhealthyShutdownStarted = false
+			h.Lock.Unlock()
+			return nil
+		}
+		h.Lock.Unlock()
+
+		_, status := h.checkOwnHealth(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if status.Health == Unhealthy {
+			now := time.Now()
+			if unhealthySince.IsZero() {
+				unhealthySince = now
+			}
+			if unhealthyFor := now.Sub(unhealthySince); unhealthyFor >= threshold {
+				h.lg.WLogf("%s has been unhealthy for %s; shutting down: %s", h.AsyncObjName(), unhealthyFor, status)
+				h.StartShutdown(&UnhealthyError{Status: status, Duration: unhealthyFor})
+				return nil
+			}
+		} else {
+			unhealthySince = time.Time{}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package asyncobj
+
+import (
+	"context"
+	"testing"
+)
+
+// panicChecker is a HealthChecker that panics
+type panicChecker struct{}
+
+func (panicChecker) Check(ctx context.Context) HealthStatus {
+	panic("health check panic")
+}
+
+func (panicChecker) Close() error {
+	return nil
+}
+
+func TestCheckHealthChildPanic(t *testing.T) {
+	parent := newTestHelper()
+	parent.SetRecoverPanics(true)
+	if err := parent.DoOnceActivate(func() error { return nil }, true); err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+	parent.AddSyncCloseChild(panicChecker{})
+	healthyChild := newTestHelper()
+	healthyChild.DoOnceActivate(func() error { return nil }, true)
+	parent.AddAsyncShutdownChild(healthyChild)
+
+	report := parent.CheckHealth(context.Background())
+	if report.Health != Unhealthy {
+		t.Fatalf("Report is %s; expected Unhealthy", report.Health)
+	}
+	if len(report.Children) != 2 {
+		t.Fatalf("Report has %d children; expected 2", len(report.Children))
+	}
+	if report.Children[0].Health != Unhealthy || report.Children[1].Health != Healthy {
+		t.Fatalf("Child reports are %s and %s; expected Unhealthy and Healthy",
+			report.Children[0].Health, report.Children[1].Health)
+	}
+	parent.Shutdown(nil)
+}
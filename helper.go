@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/sammck-go/logger"
 	llogger "github.com/sammck-go/logger"
@@ -30,6 +31,28 @@ type HandleOnceActivator interface {
 // If shutdown has already started before DoOnceActivate is called, this function will not be invoked.
 type OnceActivateCallback func() error
 
+// HandleOnceActivatorContext is a context-aware sibling of HandleOnceActivator that may be implemented by the object
+// managed by AsyncObjHelper. If the object implements both interfaces, HandleOnceActivateContext is preferred.
+type HandleOnceActivatorContext interface {
+	// HandleOnceActivateContext is called exactly once from DoOnceActivate or DoOnceActivateContext, in StateActivating,
+	// with shutdown deferred, to activate the object that supports shutdown.
+	// ctx is cancelled if the context passed to DoOnceActivateContext completes, or if shutdown is scheduled
+	// while activation is in progress. Long-running activation steps should give up promptly when ctx is done.
+	// If it returns nil, the object will be activated. If it returns an error, the object will not be activated,
+	// and shutdown will be immediately started.
+	// If shutdown has already started before DoOnceActivateContext is called, this function will not be invoked.
+	HandleOnceActivateContext(ctx context.Context) error
+}
+
+// OnceActivateContextCallback is a context-aware version of OnceActivateCallback. It is called exactly once,
+// in StateActivating, with shutdown deferred, to activate the object that supports shutdown.
+// ctx is cancelled if the context passed to DoOnceActivateContext completes, or if shutdown is scheduled
+// while activation is in progress.
+// If it returns nil, the object will be activated. If it returns an error, the object will not be activated,
+// and shutdown will be immediately started.
+// If shutdown has already started before DoOnceActivateContext is called, this function will not be invoked.
+type OnceActivateContextCallback func(ctx context.Context) error
+
 // OnceShutdownHandler is a function that will be called exactly once, in StateShuttingDown, in its own goroutine.
 // It should take completionError as an advisory completion value, actually shut down, then return the real completion value.
 // This function will never be called while shutdown is deferred (and hence, will never be called during activation).
@@ -45,6 +68,42 @@ type HandleOnceShutdowner interface {
 	HandleOnceShutdown(completionError error) error
 }
 
+// OnceShutdownContextHandler is a context-aware version of OnceShutdownHandler. It will be called exactly once,
+// in StateShuttingDown, in its own goroutine. ctx is cancelled when the graceful shutdown deadline configured
+// with SetShutdownTimeouts expires, at which point the handler should abandon any remaining graceful cleanup
+// and return as quickly as possible.
+type OnceShutdownContextHandler func(ctx context.Context, completionError error) error
+
+// HandleOnceShutdownerContext is a context-aware sibling of HandleOnceShutdowner that may be implemented by the
+// object managed by AsyncObjHelper. If the object implements both interfaces, HandleOnceShutdownContext is preferred.
+type HandleOnceShutdownerContext interface {
+	// HandleOnceShutdownContext will be called exactly once, in StateShuttingDown, in its own goroutine. It should take
+	// completionError as an advisory completion value, actually shut down, then return the real completion value.
+	// ctx is cancelled when the graceful shutdown deadline configured with SetShutdownTimeouts expires.
+	// This method will never be called while shutdown is deferred.
+	HandleOnceShutdownContext(ctx context.Context, completionError error) error
+}
+
+// ForceShutdownHandler is a function that is called at most once, in its own goroutine, if the shutdown handler
+// has not returned by the graceful shutdown deadline configured with SetShutdownTimeouts. It should take
+// whatever drastic action is necessary (closing sockets, killing processes, etc.) to unblock the shutdown
+// handler. completionError is the advisory completion value that was passed to the shutdown handler.
+type ForceShutdownHandler func(completionError error)
+
+// HandleForceShutdowner is an interface that may be implemented by the object managed by AsyncObjHelper if
+// the object provides its own HandleForceShutdown method. If the object does not provide this method, a handler
+// function can be provided with SetForceShutdownHandler.
+type HandleForceShutdowner interface {
+	// HandleForceShutdown is called at most once, in its own goroutine, if the shutdown handler has not returned by
+	// the graceful shutdown deadline. It should take whatever drastic action is necessary to unblock the
+	// shutdown handler.
+	HandleForceShutdown(completionError error)
+}
+
+// ErrShutdownTimeout is the final completion status of a Helper whose shutdown handler did not return
+// before the hard shutdown deadline configured with SetShutdownTimeouts.
+var ErrShutdownTimeout = errors.New("Shutdown handler did not complete before the hard shutdown deadline")
+
 // HandleOnceActivateShutdowner includes all of the methods from both HandleOnceActivator and HandleOnceShutdowner
 type HandleOnceActivateShutdowner interface {
 	HandleOnceActivator
@@ -52,11 +111,11 @@ type HandleOnceActivateShutdowner interface {
 }
 
 // State represents a discreet state in the Helper state machine. During transitions, the state can only move
-// to a higher state number.
+// to a higher state number, except that Resume moves the state from StateSuspended back to StateActivated.
 type State int
 
 // Various State values for the Helper state machine. During transitions, the state can only move
-// to a higher state number.
+// to a higher state number, except that Resume moves the state from StateSuspended back to StateActivated.
 const (
 	// StateUnactivated indicates that activation has not yet started
 	StateUnactivated State = iota
@@ -70,6 +129,21 @@ const (
 	// shutting down.  Note that a shutdown may have been scheduled, if shutdown is deferred.
 	StateActivated State = iota
 
+	// StateSuspending indicates that Suspend has been called on an activated object, and the object
+	// and its children are being suspended. Shutdown is deferred during this state. If suspension
+	// fails, there will be a transition back to StateActivated.
+	StateSuspending State = iota
+
+	// StateSuspended indicates that the object has been paused without being torn down. Resume returns the
+	// object to StateActivated. Shutdown may be started from this state, and proceeds normally.
+	StateSuspended State = iota
+
+	// StateDraining indicates that shutdown has begun, but in-flight operations registered with Enter are
+	// being allowed to finish before the shutdown handler runs. New operations cannot be entered, and shutdown
+	// can no longer be deferred. This state is only entered by objects that use Enter or SetDrainTimeout, and
+	// lasts until all operations have exited or the drain timeout expires.
+	StateDraining State = iota
+
 	// StateShuttingDown indicates that shutdown has been initiated. shutdown can no longer
 	// be deferred. APIs should complete quickly and may return errors. Note that this state
 	// may be entered without ever entering StateActivating or StateActivated, if shutdown
@@ -86,6 +160,53 @@ const (
 	StateShutDown State = iota
 )
 
+// String returns a human-readable name for a State
+func (s State) String() string {
+	switch s {
+	case StateUnactivated:
+		return "StateUnactivated"
+	case StateActivating:
+		return "StateActivating"
+	case StateActivated:
+		return "StateActivated"
+	case StateSuspending:
+		return "StateSuspending"
+	case StateSuspended:
+		return "StateSuspended"
+	case StateDraining:
+		return "StateDraining"
+	case StateShuttingDown:
+		return "StateShuttingDown"
+	case StateLocalShutdown:
+		return "StateLocalShutdown"
+	case StateShutDown:
+		return "StateShutDown"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// WaitAbortedError is returned by the context-bounded wait methods of Helper (WaitShutdownContext,
+// ShutdownContext, etc.) when the context completes before the awaited state is reached. Any shutdown
+// that has been started continues in the background. It wraps the context's error, so
+// errors.Is(err, context.DeadlineExceeded) and errors.Is(err, context.Canceled) work as expected.
+type WaitAbortedError struct {
+	// State is the state of the Helper at the time the wait was abandoned
+	State State
+
+	// Err is the error returned by the context's Err() method
+	Err error
+}
+
+// Error returns a description of the abandoned wait
+func (e *WaitAbortedError) Error() string {
+	return fmt.Sprintf("Wait abandoned in %s: %s", e.State, e.Err)
+}
+
+// Unwrap returns the context's error
+func (e *WaitAbortedError) Unwrap() error {
+	return e.Err
+}
+
 type AsyncHelper interface {
 	AsyncShutdowner
 	io.Closer
@@ -146,7 +267,8 @@ type AsyncHelper interface {
 	// can be scheduled). Because of this, onceActivateCallback *must not* wait for shutdown
 	// or call Close(), since a deadlock will result.
 	//
-	// If onceActivateCallback is nil, interface HandleOnceActivator on the object must be implemented and is used instead.
+	// If onceActivateCallback is nil, interface HandleOnceActivator on the object must be implemented and is used instead;
+	// if it is not, activation fails with an error.
 	//
 	// The caller must not call this method with waitOnFail==true if shutdowns are deferred, unless
 	// these deferrals can be released before DoOnceActivate returns; otherwise a deadlock will occur.
@@ -171,8 +293,9 @@ type AsyncHelper interface {
 	// is started and completes
 	IsScheduledShutdown() bool
 
-	// IsStartedShutdown returns true if shutdown has begun, and shutdown can no longer be deferred.
-	// It continues to return true after shutdown is complete.
+	// IsStartedShutdown returns true if shutdown has begun, and shutdown can no longer be deferred. For
+	// objects that drain (see Enter), this is true from the time StateDraining is entered, before
+	// ShutdownStartedChan is closed. It continues to return true after shutdown is complete.
 	IsStartedShutdown() bool
 
 	// IsDoneLocalShutdown returns true if local shutdown is complete, not including cleanup of
@@ -194,8 +317,10 @@ type AsyncHelper interface {
 	ShutdownWGAdd(delta int) (*sync.WaitGroup, error)
 
 	// ShutdownStartedChan returns a channel that will be closed as soon as StateShuttingDown is entered and
-	// shutdown can no longer be deferred. Anyone
-	// can use this channel to be notified when the object has begun shutting down.
+	// the shutdown handler is about to run. Anyone
+	// can use this channel to be notified when the object has begun shutting down. For objects that
+	// drain (see Enter), it is closed only when draining ends; DrainingChan is closed as soon as
+	// shutdown is scheduled.
 	ShutdownStartedChan() <-chan struct{}
 
 	// LocalShutdownDoneChan returns a channel that will be closed when StateLocalShutdown
@@ -231,24 +356,27 @@ type AsyncHelper interface {
 	// before this object's shutdown is considered complete. The caller should close the
 	// chan when conditions have been met to allow shutdown to complete. The Helper will not take
 	// any action to cause the chan to be closed; it is the caller's responsibility to do that.
+	// On success, a ChildHandle is returned that can be used to unregister the chan.
 	// An error is returned if StateShutdown has already been reached.
-	AddShutdownChildChan(childDoneChan <-chan struct{}) error
+	AddShutdownChildChan(childDoneChan <-chan struct{}) (ChildHandle, error)
 
 	// AddAsyncShutdownChild adds a dependent child object that implements AsyncShutdowner to
 	// the set of objects that will be actively shut down by this helper after StateLocalShutdown, before this
 	// object's shutdown is considered complete. The child will be shut down in parallel with shutdown of other
 	// children, with an advisory completion status equal to the status returned from HandleOnceShutdown.
-	// The childs final completion code is ignored.
+	// The childs final completion code is ignored unless a ChildErrorPolicy other than IgnoreChildErrors has been set.
+	// On success, a ChildHandle is returned that can be used to unregister the child.
 	// An error is returned if StateShutdown has already been reached.
-	AddAsyncShutdownChild(child AsyncShutdowner) error
+	AddAsyncShutdownChild(child AsyncShutdowner) (ChildHandle, error)
 
 	// AddSyncCloseChild adds a dependent child object that implements io.Closer to the set of objects
 	// that will be actively closed by this helper after StateLocalShutdown, before this
-	// object's shutdown is considered complete. The child will be Close()'d in its own
-	// goroutine, in parallel with shutdown and closure of other dependent children. The return code
-	// of the child's Close() method is ignored.
+	// object's shutdown is considered complete. The child will be Close()'d in parallel with shutdown and
+	// closure of other dependent children, subject to the limit set by SetChildShutdownParallelism. The return code
+	// of the child's Close() method is ignored unless a ChildErrorPolicy other than IgnoreChildErrors has been set.
+	// On success, a ChildHandle is returned that can be used to unregister the child.
 	// An error is returned if StateShutdown has already been reached.
-	AddSyncCloseChild(child io.Closer) error
+	AddSyncCloseChild(child io.Closer) (ChildHandle, error)
 }
 
 // Helper is a a state machine that manages clean asynchronous object activation and shutdown.
@@ -274,6 +402,22 @@ type Helper struct {
 	// when shutdown is deferred.
 	shutdownHandler OnceShutdownHandler
 
+	// shutdownContextHandler is a context-aware alternative to shutdownHandler. At most one
+	// of the two is non-nil.
+	shutdownContextHandler OnceShutdownContextHandler
+
+	// forceShutdownHandler is called if the shutdown handler has not returned by the graceful
+	// shutdown deadline.
+	forceShutdownHandler ForceShutdownHandler
+
+	// gracefulShutdownTimeout is the time after StateShuttingDown is entered at which the
+	// shutdown handler's context is cancelled and forced shutdown begins. 0 means no limit.
+	gracefulShutdownTimeout time.Duration
+
+	// forceShutdownTimeout is the time after forced shutdown begins at which the shutdown handler
+	// is abandoned. 0 means no limit.
+	forceShutdownTimeout time.Duration
+
 	// shutdownDeferCount is the number of times UndeferShutdown() must be called before
 	// shutdown can commence. It cannot be incremented once shutdown has started. If
 	// isScheduledShutdown is true, then shutdown will commence when this counter becomes
@@ -292,14 +436,28 @@ type Helper struct {
 	// becomes 0.
 	isScheduledShutdown bool
 
-	// shutdownErr contains the final completion status after state >= StateLocalShutdown
+	// shutdownErr contains the local completion status after state >= StateLocalShutdown
 	shutdownErr error
 
-	// activatingDoneChan is a chan that is d when the state advances beyond StateActivating. Anyone
-	// who wants to can wait on this chan to be notified of the end of the activating phase. This
-	// signal does not mean that activation succeeded.
+	// finalShutdownErr contains the final completion status, including errors from children as
+	// determined by childErrorPolicy, after state >= StateShutDown
+	finalShutdownErr error
+
+	// childErrorPolicy determines how completion errors from children are combined into finalShutdownErr
+	childErrorPolicy ChildErrorPolicy
+
+	// childErrs collects the completion errors of children, in completion order, if childErrorPolicy
+	// is not IgnoreChildErrors
+	childErrs []error
+
+	// activatingDoneChan is a chan that is closed when the state advances beyond StateActivating, or when
+	// activation fails. Anyone who wants to can wait on this chan to be notified of the end of the
+	// activating phase. This signal does not mean that activation succeeded.
 	activatingDoneChan chan struct{}
 
+	// isActivatingDone is true once activatingDoneChan has been closed
+	isActivatingDone bool
+
 	// shutdownStartedChan is a chan that is closed when shutdown is started. Anyone
 	// who wants to can wait on this chan to be notified of the start of shutdown.
 	// This chan will never be closed while shutdown is deferred.
@@ -317,8 +475,173 @@ type Helper struct {
 	// After it is closed, anyone can wait on this chan to be notified
 	shutdownDoneChan chan struct{}
 
+	// stateObservers is the list of registered state observers, in registration order. The slice is
+	// replaced rather than modified in place, so it may be iterated without holding the lock.
+	stateObservers []*stateObserverEntry
+
+	// pendingTransitions is the queue of state transitions that have not yet been delivered to observers
+	pendingTransitions []stateTransition
+
+	// dispatchingTransitions is true while some goroutine is delivering pendingTransitions to observers
+	dispatchingTransitions bool
+
+	// activateCancel cancels the context passed to the activation callback. It is non-nil only
+	// while in StateActivating, and is called if shutdown is scheduled before activation completes.
+	activateCancel context.CancelFunc
+
+	// suspendLock serializes Suspend and Resume
+	suspendLock sync.Mutex
+
+	// suspendCancel cancels the context passed to the suspend and resume handlers. It is non-nil only
+	// while Suspend or Resume is in progress. Protected by Lock.
+	suspendCancel context.CancelFunc
+
+	// suspendedChildren is the list of children suspended by the last successful Suspend, in the order
+	// they were suspended. Protected by suspendLock.
+	suspendedChildren []suspendableChild
+
+	// drainingChan is closed as soon as shutdown is scheduled
+	drainingChan chan struct{}
+
+	// drainEnabled is true if StateDraining will be entered when shutdown starts
+	drainEnabled bool
+
+	// drainTimeout is the longest time that will be spent in StateDraining, or <= 0 for no limit
+	drainTimeout time.Duration
+
+	// inFlightOperations is the number of operations registered with Enter that have not yet exited
+	inFlightOperations int
+
+	// drainedChan is created on entry to StateDraining, and closed when there are no operations in flight
+	drainedChan chan struct{}
+
+	// isDrained is true once drainedChan has been closed
+	isDrained bool
+
+	// isForcedDrain is true if draining has been cut short by forceShutdown
+	isForcedDrain bool
+
+	// drainSpan is the span opened for StateDraining, if tracing is enabled
+	drainSpan Span
+
+	// children is the set of registered dependent children, in no particular order. Each registration
+	// records its own index in this slice so it can be removed in constant time. The shutdown goroutine
+	// takes ownership of the entire set upon entering StateLocalShutdown.
+	children []*childRegistration
+
+	// childPruneThreshold is the size that children must reach before registrations of
+	// children that have already finished are pruned from it.
+	childPruneThreshold int
+
+	// childShutdownParallelism is the maximum number of io.Closer children that will be closed
+	// concurrently during shutdown. 0 means no limit.
+	childShutdownParallelism int
+
+	// activatableChildren contains the registrations of children added with AddActivatableChild, in
+	// registration order. It is released when activation starts.
+	activatableChildren []*childRegistration
+
+	// parallelChildActivation is true if activatable children are activated concurrently rather than
+	// in registration order
+	parallelChildActivation bool
+
+	// lifetimeCtx is the context.Context view of the lifetime of this helper returned by Context()
+	lifetimeCtx *helperContext
+
+	// advisoryShutdownErr is the advisory completion status passed to the first call to StartShutdown.
+	// Unlike shutdownErr, it is not replaced once the shutdown handler returns.
+	advisoryShutdownErr error
+
+	// shutdownOnGoError is true if a function run with Go that returns an error should start shutdown
+	shutdownOnGoError bool
+
+	// healthChecker reports the health of the object while it is activated, or is nil
+	healthChecker HealthChecker
+
+	// unhealthyCheckInterval is how often the policy set with SetUnhealthyShutdown checks health
+	unhealthyCheckInterval time.Duration
+
+	// unhealthyShutdownThreshold is how long the object may be continuously Unhealthy before shutdown
+	// is started, or <= 0 if the policy is disabled
+	unhealthyShutdownThreshold time.Duration
+
+	// unhealthyShutdownStarted is true if the goroutine that enforces the unhealthy shutdown policy is running
+	unhealthyShutdownStarted bool
+
+	// recoverPanics is true if panics in callbacks should be converted to *PanicError
+	recoverPanics bool
+
+	// runningGoroutines counts the goroutines started with Go that have not yet returned, by name
+	runningGoroutines map[string]int
+
+	// name identifies the object in diagnostics. If empty, a name is derived from obj.
+	name string
+
+	// watchdogThreshold is the time a phase of shutdown may last before the watchdog reports it.
+	// 0 disables the watchdog.
+	watchdogThreshold time.Duration
+
+	// watchdogMaxInterval is the maximum interval between repeated watchdog reports. 0 means no limit.
+	watchdogMaxInterval time.Duration
+
+	// shutdownPhase describes the current phase of shutdown, for the watchdog
+	shutdownPhase string
+
+	// shutdownPhaseStart is the time at which the current phase of shutdown began
+	shutdownPhaseStart time.Time
+
+	// pendingChildren is the set of children that are being shut down and have not yet finished
+	pendingChildren map[*childRegistration]struct{}
+
+	// leakTracker detects garbage collection of the helper before StateShutDown, if leak detection
+	// was enabled when the helper was created
+	leakTracker *leakTracker
+
+	// metrics is the registry into which lifecycle metrics are reported, or nil
+	metrics *MetricsRegistry
+
+	// metricsKind is the kind under which this object's metrics are reported
+	metricsKind string
+
+	// activationErr is the error returned by the activation callback (or by SetIsActivated) if activation failed
+	activationErr error
+
+	// tracer opens spans for activation and shutdown, or is nil if tracing is disabled
+	tracer Tracer
+
+	// traceParent is the parent of the next span opened by this helper, as set by setTraceParent
+	traceParent Span
+
+	// currentSpan is the span that is open for activation or shutdown, which is the parent of spans
+	// opened by children registered while it is open
+	currentSpan Span
+
+	// shutdownSpan is the span covering the entire shutdown, if tracing is enabled
+	shutdownSpan Span
+
+	// shutdownHandlerCancel cancels the context passed to the shutdown handler
+	shutdownHandlerCancel context.CancelFunc
+
+	// isShutdownHandlerAbandoned is true while a shutdown handler abandoned after the force shutdown
+	// timeout is still running
+	isShutdownHandlerAbandoned bool
+
+	// isForcedShutdown is set when forced shutdown begins, either because the graceful shutdown deadline
+	// expired or because of signal escalation
+	isForcedShutdown bool
+
+	// signalEscalation determines what happens when a signal is received after shutdown has started
+	signalEscalation SignalEscalation
+
+	// signalExitCode is the process exit code used by EscalateExit
+	signalExitCode int
+
+	// wgAddTotal is the total of all deltas passed to ShutdownWGAdd. The number outstanding cannot be
+	// known, since callers call Done() directly on the waitgroup.
+	wgAddTotal int
+
 	// wg is a sync.WaitGroup that this helper will wait on before it considers final shutdown
-	// to be complete. it is incremented for each dependent that we are waiting on. It cannot
+	// to be complete. it is incremented for each background task that we are waiting on. It cannot
 	// be incremented after StateShutdown is entered.
 	wg sync.WaitGroup
 }
@@ -346,6 +669,7 @@ func (h *Helper) InitHelperWithShutdownHandler(
 	h.state = StateUnactivated
 	h.shutdownHandler = shutdownHandler
 	h.activatingDoneChan = make(chan struct{})
+	h.drainingChan = make(chan struct{})
 	h.shutdownStartedChan = make(chan struct{})
 	h.localShutdownDoneChan = make(chan struct{})
 	h.shutdownDoneChan = make(chan struct{})
@@ -363,7 +687,7 @@ func (h *Helper) InitHelper(
 // NewHelperWithShutdownHandler creates a new Helper as its own object with an independent
 // shutdown handler function.
 // if logger is nil, a NilLogger is attached.
-// If shutDownHandler is nil, then obj must implement HandleOnceShutdowner
+// If shutDownHandler is nil, then obj must implement HandleOnceShutdowner or HandleOnceShutdownerContext
 func NewHelperWithShutdownHandler(
 	obj interface{},
 	logger logger.Logger,
@@ -371,21 +695,30 @@ func NewHelperWithShutdownHandler(
 ) AsyncHelper {
 	if shutdownHandler == nil {
 		// panic early if required interface not implemented
-		_ = obj.(HandleOnceShutdowner)
+		if _, ok := obj.(HandleOnceShutdownerContext); !ok {
+			_ = obj.(HandleOnceShutdowner)
+		}
 	}
 	if logger == nil {
 		logger = llogger.NilLogger
 	}
 	h := &Helper{
-		lg:                    logger,
-		obj:                   obj,
-		state:                 StateUnactivated,
-		shutdownHandler:       shutdownHandler,
-		activatingDoneChan:    make(chan struct{}),
-		shutdownStartedChan:   make(chan struct{}),
-		localShutdownDoneChan: make(chan struct{}),
-		shutdownDoneChan:      make(chan struct{}),
+		lg:                       logger,
+		obj:                      obj,
+		state:                    StateUnactivated,
+		shutdownHandler:          shutdownHandler,
+		childPruneThreshold:      minChildPruneThreshold,
+		childShutdownParallelism: DefaultChildShutdownParallelism,
+		activatingDoneChan:       make(chan struct{}),
+		drainingChan:             make(chan struct{}),
+		shutdownStartedChan:      make(chan struct{}),
+		localShutdownDoneChan:    make(chan struct{}),
+		shutdownDoneChan:         make(chan struct{}),
 	}
+	h.lifetimeCtx = &helperContext{h: h}
+	h.Lock.Lock()
+	h.lockedEnableLeakDetection()
+	h.Lock.Unlock()
 	return h
 }
 
@@ -408,6 +741,9 @@ func (h *Helper) Lg() logger.Logger {
 
 func (h *Helper) SetLg(lg logger.Logger) {
 	h.lg = lg
+	if h.leakTracker != nil {
+		h.leakTracker.setNameAndLogger(h.AsyncObjName(), lg)
+	}
 }
 
 // SetOnceShutdownHandler sets the callback that will be made for shutdown.
@@ -419,6 +755,54 @@ func (h *Helper) SetOnceShutdownHandler(callback OnceShutdownHandler) error {
 		return errors.New("Cannot SetOnceShutdownHandler after activation")
 	}
 	h.shutdownHandler = callback
+	h.shutdownContextHandler = nil
+	return nil
+}
+
+// SetOnceShutdownContextHandler sets a context-aware callback that will be made for shutdown, replacing
+// any callback set with SetOnceShutdownHandler.
+// Cannot be called after activation.
+func (h *Helper) SetOnceShutdownContextHandler(callback OnceShutdownContextHandler) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.state >= StateActivated {
+		return errors.New("Cannot SetOnceShutdownContextHandler after activation")
+	}
+	h.shutdownContextHandler = callback
+	h.shutdownHandler = nil
+	return nil
+}
+
+// SetForceShutdownHandler sets the callback that will be made if the shutdown handler has not returned
+// by the graceful shutdown deadline. If not set, and the object implements HandleForceShutdowner, that
+// is used instead.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetForceShutdownHandler(callback ForceShutdownHandler) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetForceShutdownHandler after shutdown has started")
+	}
+	h.forceShutdownHandler = callback
+	return nil
+}
+
+// SetShutdownTimeouts places time limits on the shutdown handler. If gracefulTimeout is > 0 and the handler
+// has not returned gracefulTimeout after StateShuttingDown is entered, the handler's context is cancelled
+// and the force shutdown handler is invoked. If, in addition, forceTimeout is > 0 and the handler still has not
+// returned forceTimeout after that, the handler is abandoned and the helper moves on to StateLocalShutdown
+// with a final completion status of ErrShutdownTimeout. The abandoned handler goroutine is not counted in the
+// shutdown waitgroup, since it may never return; while it is still running, it is listed in ObjectTree and
+// in watchdog reports.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetShutdownTimeouts(gracefulTimeout time.Duration, forceTimeout time.Duration) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetShutdownTimeouts after shutdown has started")
+	}
+	h.gracefulShutdownTimeout = gracefulTimeout
+	h.forceShutdownTimeout = forceTimeout
 	return nil
 }
 
@@ -436,7 +820,7 @@ func (h *Helper) GetAsyncObjState() State {
 func (h *Helper) DeferShutdown() error {
 	h.Lock.Lock()
 	defer h.Lock.Unlock()
-	if h.state >= StateShuttingDown {
+	if h.lockedIsStartedShutdown() {
 		return errors.New("Shutdown already started; cannot defer")
 	}
 	h.shutdownDeferCount++
@@ -458,19 +842,20 @@ func (h *Helper) IsActivated() bool {
 // the application can simply call SetIsActivated() after construction and before returning the new object--the object
 // will never be seen in an inactive or activating state. If this approach is taken, the application *must*
 // call SetIsActivated() at construct time, or it is responsible for calling StartShutdown to clean up and drive the state
-// to StateShutdown before the object is garbage collected.
+// to StateShutdown before the object is garbage collected. Violations can be found with SetLeakDetection.
 func (h *Helper) SetIsActivated() error {
 	h.Lock.Lock()
-	defer h.Lock.Unlock()
-
 	if !h.isActivated {
-		if h.state >= StateShuttingDown {
+		if h.lockedIsStartedShutdown() {
+			h.Lock.Unlock()
 			return errors.New("Cannot activate; shutdown already initiated")
 		}
 		h.isActivated = true
-		h.state = StateActivated
-		close(h.activatingDoneChan)
+		h.lockedSetState(StateActivated, nil)
+		h.lockedCloseActivatingDoneChan()
 	}
+	h.Lock.Unlock()
+	h.dispatchStateTransitions()
 
 	return nil
 }
@@ -515,11 +900,43 @@ func (h *Helper) SetIsActivated() error {
 // can be scheduled). Because of this, onceActivateCallback *must not* wait for shutdown
 // or call Close(), since a deadlock will result.
 //
-// if onceActivateCallback is nil, interface HandleOnceActivator on the object must be implemented and is used instead.
+// if onceActivateCallback is nil, interface HandleOnceActivator on the object must be implemented and is used instead;
+// if it is not, activation fails with an error.
 //
 // The caller must not call this method with waitOnFail==true if shutdowns are deferred, unless
 // these deferrals can be released before DoOnceActivate returns; otherwise a deadlock will occur.
 func (h *Helper) DoOnceActivate(onceActivateCallback OnceActivateCallback, waitOnFail bool) error {
+	var callback OnceActivateContextCallback
+	if onceActivateCallback != nil {
+		callback = func(ctx context.Context) error {
+			return onceActivateCallback()
+		}
+	}
+	return h.DoOnceActivateContext(context.Background(), callback, waitOnFail)
+}
+
+// DoOnceActivateContext is the same as DoOnceActivate, except that the activation callback receives a
+// context that is cancelled when ctx completes or when shutdown is scheduled during StateActivating. This
+// allows slow activation (dialing, loading state, etc.) to be abandoned as soon as it is no longer wanted,
+// rather than holding off a scheduled shutdown until it finishes on its own.
+//
+// If ctx completes while this caller is waiting for another caller's activation to finish, this method
+// gives up and returns a *WaitAbortedError wrapping ctx.Err() without affecting the object's state. Likewise,
+// if waitOnFail is true and ctx completes while waiting for shutdown after a failed activation, the activation
+// error is returned without waiting further.
+//
+// If shutdown had already started before this method was called and waitOnFail is true, the result of
+// WaitShutdownContext is returned if it is non-nil: the object's final completion status, or a
+// *WaitAbortedError if ctx completes first. Otherwise an error reporting that shutdown had already started
+// is returned.
+//
+// If onceActivateCallback is nil, interface HandleOnceActivatorContext or HandleOnceActivator on the object
+// must be implemented and is used instead, in that order of preference. If neither is, activation fails with an error.
+func (h *Helper) DoOnceActivateContext(
+	ctx context.Context,
+	onceActivateCallback OnceActivateContextCallback,
+	waitOnFail bool,
+) error {
 	var err error
 	h.Lock.Lock()
 	if h.isActivated {
@@ -531,7 +948,10 @@ func (h *Helper) DoOnceActivate(onceActivateCallback OnceActivateCallback, waitO
 		// activating already started by someone else... Wait for it to finish before figuring
 		// out what to do next
 		h.Lock.Unlock()
-		<-h.activatingDoneChan
+		err = h.waitChanContext(ctx, h.activatingDoneChan)
+		if err != nil {
+			return err
+		}
 		h.Lock.Lock()
 	}
 
@@ -541,11 +961,11 @@ func (h *Helper) DoOnceActivate(onceActivateCallback OnceActivateCallback, waitO
 		return nil
 	}
 
-	if h.state >= StateShuttingDown {
+	if h.lockedIsStartedShutdown() {
 		// Shutdown has already started. Optionally wait for complete shutdown, and return an error
 		h.Lock.Unlock()
 		if waitOnFail {
-			err = h.WaitShutdown()
+			err = h.WaitShutdownContext(ctx)
 		}
 		if err == nil {
 			err = errors.New("Shutdown of object already started; cannot SetIsActivated")
@@ -553,22 +973,78 @@ func (h *Helper) DoOnceActivate(onceActivateCallback OnceActivateCallback, waitO
 		return err
 	}
 
+	if h.activationErr != nil {
+		// Activation failed, and shutdown has been scheduled but is still deferred
+		err = h.activationErr
+		h.Lock.Unlock()
+		if waitOnFail {
+			h.WaitShutdownContext(ctx)
+		}
+		return err
+	}
+
 	// Defer shutdowns while activating
 	h.shutdownDeferCount++
 
-	h.state = StateActivating
+	h.lockedSetState(StateActivating, nil)
+	activateSpan := h.lockedStartSpan("activate", nil)
+	h.currentSpan = activateSpan
+	activateCtx, cancel := context.WithCancel(ctx)
+	if h.isScheduledShutdown {
+		// Shutdown was scheduled before we got here; don't let activation dawdle
+		cancel()
+	} else {
+		h.activateCancel = cancel
+	}
 	h.Lock.Unlock()
+	h.dispatchStateTransitions()
+
+	if onceActivateCallback == nil {
+		if activator, ok := h.obj.(HandleOnceActivatorContext); ok {
+			onceActivateCallback = activator.HandleOnceActivateContext
+		} else if activator, ok := h.obj.(HandleOnceActivator); ok {
+			onceActivateCallback = func(ctx context.Context) error {
+				return activator.HandleOnceActivate()
+			}
+		} else {
+			onceActivateCallback = func(ctx context.Context) error {
+				return fmt.Errorf("Cannot activate %s: no activation callback, and object does not implement HandleOnceActivator",
+					h.AsyncObjName())
+			}
+		}
+	}
 
-	if onceActivateCallback != nil {
-		err = onceActivateCallback()
-	} else {
-		err = h.obj.(HandleOnceActivator).HandleOnceActivate()
+	// Children added with AddActivatableChild are activated before the object itself
+	activatedChildren, err := h.activateChildren(activateCtx, activateSpan)
+	if err == nil {
+		err = h.callRecovering("activation callback", func() error {
+			return onceActivateCallback(activateCtx)
+		})
 	}
 
+	h.Lock.Lock()
+	h.activateCancel = nil
+	h.Lock.Unlock()
+	cancel()
+
 	if err == nil {
 		err = h.SetIsActivated()
 	}
 
+	if err != nil {
+		h.rollbackChildActivation(activatedChildren, err)
+	}
+
+	h.Lock.Lock()
+	h.currentSpan = nil
+	h.activationErr = err
+	if err != nil {
+		// Activation is over even if shutdown is held off by another deferral
+		h.lockedCloseActivatingDoneChan()
+	}
+	h.Lock.Unlock()
+	endSpan(activateSpan, err)
+
 	if err != nil {
 		h.StartShutdown(err)
 	}
@@ -579,19 +1055,31 @@ func (h *Helper) DoOnceActivate(onceActivateCallback OnceActivateCallback, waitO
 
 	// On error, optionally wait for complete shutdown
 	if err != nil && waitOnFail {
-		h.WaitShutdown()
+		h.WaitShutdownContext(ctx)
 	}
 
 	return err
 }
 
-// lockedEnterShuttingDownState is the common code used by StartShutdown and UndeferShutdown to
-// actually transition to StateShuttingDown.  The lock must be held when this method is called.
+// lockedCloseActivatingDoneChan closes activatingDoneChan if it has not already been closed. The lock must be
+// held when this method is called.
+func (h *Helper) lockedCloseActivatingDoneChan() {
+	if !h.isActivatingDone {
+		h.isActivatingDone = true
+		close(h.activatingDoneChan)
+	}
+}
+
+// lockedEnterShuttingDownState is the common code used by StartShutdown, UndeferShutdown and the end of
+// draining to actually transition to StateShuttingDown.  The lock must be held when this method is called.
 func (h *Helper) lockedEnterShuttingDownState() {
 	oldState := h.state
-	h.state = StateShuttingDown
+	h.lockedSetState(StateShuttingDown, h.shutdownErr)
+	h.lockedSetShutdownPhase(phaseShutdownHandler)
+	h.shutdownSpan = h.lockedStartSpan("shutdown", nil)
+	h.currentSpan = h.shutdownSpan
 	if oldState < StateActivated {
-		close(h.activatingDoneChan)
+		h.lockedCloseActivatingDoneChan()
 	}
 	// h.DLogf("->shutdownStartedChan")
 	close(h.shutdownStartedChan)
@@ -605,14 +1093,15 @@ func (h *Helper) UndeferShutdown() {
 		return
 	}
 	h.shutdownDeferCount--
-	doShutdownNow := h.shutdownDeferCount == 0 && h.isScheduledShutdown && h.state < StateShuttingDown
+	doShutdownNow := h.shutdownDeferCount == 0 && h.isScheduledShutdown && !h.lockedIsStartedShutdown()
 	if doShutdownNow {
-		h.lockedEnterShuttingDownState()
+		h.lockedBeginShutdown()
 	}
 	h.Lock.Unlock()
 
 	if doShutdownNow {
-		h.asyncDoStartedShutdown()
+		h.dispatchStateTransitions()
+		h.asyncDoBeganShutdown()
 	}
 }
 
@@ -636,6 +1125,13 @@ func (h *Helper) UndeferAndLocalShutdown(completionErr error) error {
 	return h.WaitLocalShutdown()
 }
 
+// UndeferAndLocalShutdownContext is the same as UndeferAndLocalShutdown, except that it gives up waiting
+// and returns a *WaitAbortedError if ctx completes before local shutdown is complete.
+func (h *Helper) UndeferAndLocalShutdownContext(ctx context.Context, completionErr error) error {
+	h.UndeferAndStartShutdown(completionErr)
+	return h.WaitLocalShutdownContext(ctx)
+}
+
 // UndeferAndShutdown decrements the shutdown defer count and immediately shuts down.
 // Returns the final completion code.
 // The caller must not call this method if shutdowns are deferred, unless
@@ -646,6 +1142,13 @@ func (h *Helper) UndeferAndShutdown(completionErr error) error {
 	return h.WaitShutdown()
 }
 
+// UndeferAndShutdownContext is the same as UndeferAndShutdown, except that it gives up waiting
+// and returns a *WaitAbortedError if ctx completes before shutdown is complete.
+func (h *Helper) UndeferAndShutdownContext(ctx context.Context, completionErr error) error {
+	h.UndeferAndStartShutdown(completionErr)
+	return h.WaitShutdownContext(ctx)
+}
+
 // UndeferAndLocalShutdownIfNotActivated decrements the shutdown defer count and then
 // immediately starts shutting down if the helper has not yet been activated. If
 // waitOnFail is true and the helper is not activated, waits for local shutdown, but
@@ -656,6 +1159,17 @@ func (h *Helper) UndeferAndShutdown(completionErr error) error {
 // these deferrals can be released before this method returns; otherwise a deadlock will occur.
 // This method is suitable for use in a defer statement after DeferShutdown.
 func (h *Helper) UndeferAndLocalShutdownIfNotActivated(completionErr error, waitOnFail bool) error {
+	return h.UndeferAndLocalShutdownIfNotActivatedContext(context.Background(), completionErr, waitOnFail)
+}
+
+// UndeferAndLocalShutdownIfNotActivatedContext is the same as UndeferAndLocalShutdownIfNotActivated, except
+// that if waitOnFail is true, it gives up waiting and returns a *WaitAbortedError if ctx completes before
+// local shutdown is complete.
+func (h *Helper) UndeferAndLocalShutdownIfNotActivatedContext(
+	ctx context.Context,
+	completionErr error,
+	waitOnFail bool,
+) error {
 	succeeded := h.IsActivated()
 	if !succeeded {
 		h.StartShutdown(completionErr)
@@ -664,7 +1178,7 @@ func (h *Helper) UndeferAndLocalShutdownIfNotActivated(completionErr error, wait
 	var err error = nil
 	if !succeeded {
 		if waitOnFail {
-			err = h.WaitLocalShutdown()
+			err = h.WaitLocalShutdownContext(ctx)
 		} else {
 			err = completionErr
 		}
@@ -681,6 +1195,17 @@ func (h *Helper) UndeferAndLocalShutdownIfNotActivated(completionErr error, wait
 // these deferrals can be released before this method returns; otherwise a deadlock will occur.
 // This method is suitable for use in a defer statement after DeferShutdown.
 func (h *Helper) UndeferAndShutdownIfNotActivated(completionErr error, waitOnFail bool) error {
+	return h.UndeferAndShutdownIfNotActivatedContext(context.Background(), completionErr, waitOnFail)
+}
+
+// UndeferAndShutdownIfNotActivatedContext is the same as UndeferAndShutdownIfNotActivated, except
+// that if waitOnFail is true, it gives up waiting and returns a *WaitAbortedError if ctx completes before
+// shutdown is complete.
+func (h *Helper) UndeferAndShutdownIfNotActivatedContext(
+	ctx context.Context,
+	completionErr error,
+	waitOnFail bool,
+) error {
 	succeeded := h.IsActivated()
 	if !succeeded {
 		h.StartShutdown(completionErr)
@@ -689,7 +1214,7 @@ func (h *Helper) UndeferAndShutdownIfNotActivated(completionErr error, waitOnFai
 	var err error = nil
 	if !succeeded {
 		if waitOnFail {
-			err = h.WaitShutdown()
+			err = h.WaitShutdownContext(ctx)
 		} else {
 			err = completionErr
 		}
@@ -709,6 +1234,13 @@ func (h *Helper) UndeferAndWaitLocalShutdown(completionErr error) error {
 	return h.WaitLocalShutdown()
 }
 
+// UndeferAndWaitLocalShutdownContext is the same as UndeferAndWaitLocalShutdown, except that it gives up
+// waiting and returns a *WaitAbortedError if ctx completes before local shutdown is complete.
+func (h *Helper) UndeferAndWaitLocalShutdownContext(ctx context.Context, completionErr error) error {
+	h.UndeferShutdown()
+	return h.WaitLocalShutdownContext(ctx)
+}
+
 // UndeferAndWaitShutdown decrements the shutdown defer count and waits for shutdown.
 // Returns the final completion code. Does not actually initiate shutdown, so intended
 // for cases when you wish to wait for the natural life of the object.
@@ -720,6 +1252,13 @@ func (h *Helper) UndeferAndWaitShutdown(completionErr error) error {
 	return h.WaitShutdown()
 }
 
+// UndeferAndWaitShutdownContext is the same as UndeferAndWaitShutdown, except that it gives up
+// waiting and returns a *WaitAbortedError if ctx completes before shutdown is complete.
+func (h *Helper) UndeferAndWaitShutdownContext(ctx context.Context, completionErr error) error {
+	h.UndeferShutdown()
+	return h.WaitShutdownContext(ctx)
+}
+
 // ShutdownOnContext begins background monitoring of a context.Context, and
 // will begin asynchronously shutting down this helper with the context's error
 // if the context is completed. This method does not block, it just
@@ -742,12 +1281,19 @@ func (h *Helper) IsScheduledShutdown() bool {
 	return h.isScheduledShutdown
 }
 
-// IsStartedShutdown returns true if shutdown has begun. It continues to return true after shutdown
-// is complete
+// IsStartedShutdown returns true if shutdown has begun, meaning that StateDraining (for objects that drain;
+// see Enter) or StateShuttingDown has been entered, and shutdown can no longer be deferred. It continues to
+// return true after shutdown is complete
 func (h *Helper) IsStartedShutdown() bool {
 	h.Lock.Lock()
 	defer h.Lock.Unlock()
-	return h.state >= StateShuttingDown
+	return h.lockedIsStartedShutdown()
+}
+
+// lockedIsStartedShutdown returns true if shutdown has begun. This is the single definition of "shutdown
+// has started" used throughout the helper. The lock must be held when this method is called.
+func (h *Helper) lockedIsStartedShutdown() bool {
+	return h.state >= StateDraining
 }
 
 // IsDoneLocalShutdown returns true if local shutdown is complete, not including shutdown of dependents. If
@@ -783,11 +1329,13 @@ func (h *Helper) ShutdownWGAdd(delta int) (*sync.WaitGroup, error) {
 		return nil, errors.New("Cannot add to ShutdownWG after StateShutdown")
 	}
 	h.wg.Add(delta)
+	h.wgAddTotal += delta
 	return &h.wg, nil
 }
 
-// ShutdownStartedChan returns a channel that will be closed as soon as shutdown is initiated. Anyone
-// can use this channel to be notified when the object has begun shutting down.
+// ShutdownStartedChan returns a channel that will be closed as soon as StateShuttingDown is entered. Anyone
+// can use this channel to be notified when the object has begun shutting down. For objects that drain,
+// this is after StateDraining; see DrainingChan.
 func (h *Helper) ShutdownStartedChan() <-chan struct{} {
 	return h.shutdownStartedChan
 }
@@ -819,15 +1367,55 @@ func (h *Helper) WaitLocalShutdown() error {
 }
 
 // WaitShutdown waits for the shutdown to complete, including shutdown of all dependents, then
-// returns the shutdown status. It does not initiate shutdown, so it can be used to wait on
+// returns the final shutdown status, which includes errors from children if a ChildErrorPolicy
+// has been set. It does not initiate shutdown, so it can be used to wait on
 // an object that will shutdown at an unspecified point in the future.
 // The caller must not call this method if shutdowns are deferred, unless
 // these deferrals can be released before this method returns; otherwise a deadlock will occur.
 func (h *Helper) WaitShutdown() error {
 	<-h.shutdownDoneChan
+	return h.finalShutdownErr
+}
+
+// waitChanContext waits for doneChan to be closed or for ctx to complete, whichever comes first.
+// Returns nil if doneChan was closed, or a *WaitAbortedError wrapping ctx.Err() if ctx completed first.
+func (h *Helper) waitChanContext(ctx context.Context, doneChan <-chan struct{}) error {
+	// Prefer doneChan if both are ready
+	select {
+	case <-doneChan:
+		return nil
+	default:
+	}
+	select {
+	case <-doneChan:
+		return nil
+	case <-ctx.Done():
+		return &WaitAbortedError{State: h.GetAsyncObjState(), Err: ctx.Err()}
+	}
+}
+
+// WaitLocalShutdownContext is the same as WaitLocalShutdown, except that it gives up waiting and
+// returns a *WaitAbortedError wrapping ctx.Err() if ctx completes before local shutdown is complete.
+// Because the wait can be bounded, it is safe to call while shutdowns are deferred.
+func (h *Helper) WaitLocalShutdownContext(ctx context.Context) error {
+	err := h.waitChanContext(ctx, h.localShutdownDoneChan)
+	if err != nil {
+		return err
+	}
 	return h.shutdownErr
 }
 
+// WaitShutdownContext is the same as WaitShutdown, except that it gives up waiting and
+// returns a *WaitAbortedError wrapping ctx.Err() if ctx completes before shutdown is complete.
+// Because the wait can be bounded, it is safe to call while shutdowns are deferred.
+func (h *Helper) WaitShutdownContext(ctx context.Context) error {
+	err := h.waitChanContext(ctx, h.shutdownDoneChan)
+	if err != nil {
+		return err
+	}
+	return h.finalShutdownErr
+}
+
 // LocalShutdown performs a synchronous local shutdown, but does not wait for dependents to
 // fully shut down. It initiates shutdown if it has not already started, waits for local
 // shutdown to comlete, then returns the final shutdown status.
@@ -838,6 +1426,13 @@ func (h *Helper) LocalShutdown(completionError error) error {
 	return h.WaitLocalShutdown()
 }
 
+// LocalShutdownContext is the same as LocalShutdown, except that it gives up waiting and returns a
+// *WaitAbortedError if ctx completes before local shutdown is complete. Shutdown continues in the background.
+func (h *Helper) LocalShutdownContext(ctx context.Context, completionError error) error {
+	h.StartShutdown(completionError)
+	return h.WaitLocalShutdownContext(ctx)
+}
+
 // Shutdown performs a synchronous shutdown. It initiates shutdown if it has
 // not already started, waits for the shutdown to comlete, then returns
 // the final shutdown status.
@@ -848,30 +1443,183 @@ func (h *Helper) Shutdown(completionError error) error {
 	return h.WaitShutdown()
 }
 
+// ShutdownContext is the same as Shutdown, except that it gives up waiting and returns a
+// *WaitAbortedError if ctx completes before shutdown is complete. Shutdown continues in the background,
+// so this is suitable for bounded teardown where one stuck dependent must not hang process exit.
+func (h *Helper) ShutdownContext(ctx context.Context, completionError error) error {
+	h.StartShutdown(completionError)
+	return h.WaitShutdownContext(ctx)
+}
+
+// invokeShutdownHandler calls whichever shutdown handler is in effect for this helper, and returns
+// its result.
+func (h *Helper) invokeShutdownHandler(ctx context.Context, completionErr error) error {
+	if h.shutdownContextHandler != nil {
+		return h.shutdownContextHandler(ctx, completionErr)
+	}
+	if h.shutdownHandler != nil {
+		return h.shutdownHandler(completionErr)
+	}
+	if shutdowner, ok := h.obj.(HandleOnceShutdownerContext); ok {
+		return shutdowner.HandleOnceShutdownContext(ctx, completionErr)
+	}
+	if shutdowner, ok := h.obj.(HandleOnceShutdowner); ok {
+		return shutdowner.HandleOnceShutdown(completionErr)
+	}
+	h.lg.ELogf("No shutdown handler for %s; shutting down without one", h.AsyncObjName())
+	return completionErr
+}
+
+// invokeForceShutdownHandler calls whichever force shutdown handler is in effect for this helper, if any,
+// in its own goroutine.
+func (h *Helper) invokeForceShutdownHandler(completionErr error) {
+	handler := h.forceShutdownHandler
+	if handler == nil {
+		if forcer, ok := h.obj.(HandleForceShutdowner); ok {
+			handler = forcer.HandleForceShutdown
+		}
+	}
+	if handler != nil {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.callRecovering("force shutdown handler", func() error {
+				handler(completionErr)
+				return nil
+			})
+		}()
+	}
+}
+
+// forceShutdown escalates a shutdown that is taking too long. If shutdown has been scheduled but the
+// shutdown handler has not yet started, draining is cut short (immediately, or as soon as it begins if
+// shutdown is still deferred), and false is returned so that the caller may escalate again later.
+// Otherwise, it cancels the shutdown handler's context and invokes the force shutdown handler with the
+// advisory completion status, if the shutdown handler is still running and this has not already been done,
+// and returns true, since there is nothing further to escalate.
+func (h *Helper) forceShutdown() bool {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.state < StateShuttingDown {
+		h.lockedForceDrain()
+		return false
+	}
+	if h.isForcedShutdown || h.state != StateShuttingDown {
+		return true
+	}
+	h.isForcedShutdown = true
+	if h.shutdownHandlerCancel != nil {
+		h.shutdownHandlerCancel()
+	}
+	h.invokeForceShutdownHandler(h.shutdownErr)
+	return true
+}
+
+// runShutdownHandler runs the shutdown handler with an advisory completion status, enforcing the
+// graceful and forced shutdown deadlines if they have been configured, and returns the local completion status.
+// Must only be called from the shutdown goroutine, after StateShuttingDown has been entered.
+func (h *Helper) runShutdownHandler(completionErr error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.Lock.Lock()
+	h.shutdownHandlerCancel = cancel
+	h.Lock.Unlock()
+
+	invokeHandler := func() error {
+		return h.callRecovering("shutdown handler", func() error {
+			return h.invokeShutdownHandler(ctx, completionErr)
+		})
+	}
+
+	if h.gracefulShutdownTimeout <= 0 {
+		return invokeHandler()
+	}
+
+	// Run the handler in its own goroutine so we can walk away from it if necessary. An abandoned handler
+	// is not counted in the waitgroup, since it would then hold off StateShutDown forever; it is tracked
+	// with isShutdownHandlerAbandoned for diagnostics instead.
+	handlerDone := make(chan error, 1)
+	go func() {
+		err := invokeHandler()
+		// The result is delivered under the lock so that it cannot race with abandonment
+		h.Lock.Lock()
+		handlerDone <- err
+		wasAbandoned := h.isShutdownHandlerAbandoned
+		h.isShutdownHandlerAbandoned = false
+		h.Lock.Unlock()
+		if wasAbandoned {
+			h.lg.WLogf("Abandoned shutdown handler returned: %v", err)
+		}
+	}()
+
+	gracefulTimer := time.NewTimer(h.gracefulShutdownTimeout)
+	defer gracefulTimer.Stop()
+	select {
+	case err := <-handlerDone:
+		return err
+	case <-gracefulTimer.C:
+	}
+
+	h.lg.WLogf("Shutdown handler did not complete within %s; forcing shutdown", h.gracefulShutdownTimeout)
+	h.forceShutdown()
+
+	if h.forceShutdownTimeout <= 0 {
+		return <-handlerDone
+	}
+
+	forceTimer := time.NewTimer(h.forceShutdownTimeout)
+	defer forceTimer.Stop()
+	select {
+	case err := <-handlerDone:
+		return err
+	case <-forceTimer.C:
+	}
+
+	h.Lock.Lock()
+	select {
+	case err := <-handlerDone:
+		// The handler returned just as we gave up on it
+		h.Lock.Unlock()
+		return err
+	default:
+	}
+	h.isShutdownHandlerAbandoned = true
+	h.Lock.Unlock()
+	h.lg.WLogf("Shutdown handler did not complete within %s of forced shutdown; abandoning it", h.forceShutdownTimeout)
+	return ErrShutdownTimeout
+}
+
 // asyncDoStartedShutdown starts background processing of shutdown *after*
 // StateShuttingDown has already been entered and h.shutdownErr has been set
 // to the (not final) advisory completion error. It handles the remainder of
 // state transitions up to StateShutdown.
 func (h *Helper) asyncDoStartedShutdown() {
 	go func() {
-		var shutdownErr error
-		if h.shutdownHandler == nil {
-			shutdownErr = h.obj.(HandleOnceShutdowner).HandleOnceShutdown(h.shutdownErr)
-		} else {
-			shutdownErr = h.shutdownHandler(h.shutdownErr)
-		}
+		handlerSpan := h.startSpan("shutdown handler", h.shutdownSpan)
+		shutdownErr := h.runShutdownHandler(h.shutdownErr)
+		endSpan(handlerSpan, shutdownErr)
 		// h.DLogf("->shutdownHandlerDone")
 		h.Lock.Lock()
 		h.shutdownErr = shutdownErr
-		h.state = StateLocalShutdown
+		h.lockedSetState(StateLocalShutdown, shutdownErr)
+		h.lockedSetShutdownPhase(phaseChildren)
+		children := h.lockedTakeChildren()
 		close(h.localShutdownDoneChan)
 		h.Lock.Unlock()
+		h.dispatchStateTransitions()
+		h.shutdownChildren(children)
+		h.Lock.Lock()
+		h.lockedSetShutdownPhase(phaseWaitGroup)
+		h.Lock.Unlock()
 		h.wg.Wait()
 		h.Lock.Lock()
-		h.state = StateShutDown
+		h.finalShutdownErr = h.lockedCombineChildErrors()
+		h.lockedSetState(StateShutDown, h.finalShutdownErr)
 		// h.DLogf("->shutdownDone")
 		close(h.shutdownDoneChan)
 		h.Lock.Unlock()
+		endSpan(h.shutdownSpan, h.finalShutdownErr)
+		h.dispatchStateTransitions()
 	}()
 }
 
@@ -885,8 +1633,10 @@ func (h *Helper) asyncDoStartedShutdown() {
 //
 // Asynchronously, this will help kick off the following, only the first time it is called:
 //
-//  -   Signal that shutdown has been scheduled
+//  -   Signal that shutdown has been scheduled (DrainingChan)
 //  -   Wait for shutdown defer count to reach 0
+//  -   If draining is enabled, enter StateDraining and wait for in-flight operations
+//       to exit or for the drain timeout to expire
 //  -   Signal that shutdown has started
 //  -   Invoke HandleOnceShutdown with the provided avdvisory completion status. The
 //       return value will be used as the final completion status for shutdown
@@ -905,20 +1655,31 @@ func (h *Helper) StartShutdown(completionErr error) bool {
 	h.Lock.Lock()
 	isFirst := !h.isScheduledShutdown
 	if isFirst {
-		if h.state >= StateShuttingDown {
+		if h.lockedIsStartedShutdown() {
 			h.lg.Panic("shutdown started before scheduled")
 		}
 		h.shutdownErr = completionErr
+		h.advisoryShutdownErr = completionErr
 		h.isScheduledShutdown = true
+		close(h.drainingChan)
+		if h.activateCancel != nil {
+			// Shutdown was scheduled during StateActivating; ask the activation callback to give up
+			h.activateCancel()
+		}
+		if h.suspendCancel != nil {
+			// Shutdown was scheduled during Suspend or Resume; ask the handler to give up
+			h.suspendCancel()
+		}
 		doShutdownNow = (h.shutdownDeferCount == 0)
 		if doShutdownNow {
-			h.lockedEnterShuttingDownState()
+			h.lockedBeginShutdown()
 		}
 	}
 	h.Lock.Unlock()
 
 	if doShutdownNow {
-		h.asyncDoStartedShutdown()
+		h.dispatchStateTransitions()
+		h.asyncDoBeganShutdown()
 	}
 
 	return isFirst
@@ -935,86 +1696,75 @@ func (h *Helper) Close() error {
 	return h.Shutdown(nil)
 }
 
+// CloseContext is the same as Close, except that it gives up waiting and returns a
+// *WaitAbortedError if ctx completes before shutdown is complete. Shutdown continues in the background.
+func (h *Helper) CloseContext(ctx context.Context) error {
+	return h.ShutdownContext(ctx, nil)
+}
+
 // AddShutdownChildChan adds a chan that will be waited on after StateLocalShutdown,
 // before this object's shutdown is considered complete. The caller should close the
 // chan when conditions have been met to allow shutdown to complete. The Helper will not take
 // any action to cause the chan to be closed; it is the caller's responsibility to do that.
+// Registration does not consume a goroutine; chans that are closed before StateLocalShutdown
+// are periodically pruned from the set.
+// On success, a ChildHandle is returned that can be used to unregister the chan.
 // An error is returned if StateShutdown has already been reached.
-func (h *Helper) AddShutdownChildChan(childDoneChan <-chan struct{}) error {
+func (h *Helper) AddShutdownChildChan(childDoneChan <-chan struct{}) (ChildHandle, error) {
 	// h.DLogf("AddShutdownChildChan()")
 	h.Lock.Lock()
+	defer h.Lock.Unlock()
 	if h.state >= StateShutDown {
-		h.Lock.Unlock()
-		return fmt.Errorf("Cannot add shutdown child chan; StateShutdown already entered")
+		return nil, fmt.Errorf("Cannot add shutdown child chan; StateShutdown already entered")
 	}
-	h.wg.Add(1)
-	h.Lock.Unlock()
-	go func() {
-		<-childDoneChan
-		h.wg.Done()
-	}()
-	return nil
+	reg := &childRegistration{h: h, doneChan: childDoneChan}
+	h.lockedAddChild(reg)
+	return reg, nil
 }
 
 // AddAsyncShutdownChild adds a dependent asynchronous child object to the set of objects that will be
 // actively shut down by this helper after StateLocalShutdown, before this
 // object's shutdown is considered complete. The child will be shut down with an advisory
 // completion status equal to the status returned from HandleOnceShutdown. The childs final completion
-// code is ignored.
+// code is ignored unless a ChildErrorPolicy other than IgnoreChildErrors has been set. If the child
+// shuts down on its own before StateLocalShutdown, it is simply forgotten.
+// Registration does not consume a goroutine; children that shut down on their own are periodically
+// pruned from the set.
+// On success, a ChildHandle is returned that can be used to unregister the child.
 // An error is returned if StateShutdown has already been reached.
-func (h *Helper) AddAsyncShutdownChild(child AsyncShutdowner) error {
+func (h *Helper) AddAsyncShutdownChild(child AsyncShutdowner) (ChildHandle, error) {
 	// h.DLogf("AddAsyncShutdownChild(\"%s\")", child)
 	h.Lock.Lock()
 	if h.state >= StateShutDown {
 		h.Lock.Unlock()
-		return fmt.Errorf("Cannot add async shutdown child; StateShutdown already entered: \"%s\"", child)
+		return nil, fmt.Errorf("Cannot add async shutdown child; StateShutdown already entered: \"%s\"", child)
 	}
-	h.wg.Add(1)
+	reg := &childRegistration{h: h, doneChan: child.ShutdownDoneChan(), asyncChild: child}
+	h.lockedAddChild(reg)
 	h.Lock.Unlock()
-	go func() {
-		select {
-		case <-child.ShutdownDoneChan():
-			// The child was shut down by someone else before we got to StateLocalShutdown. No reason to keep waiting.
-			// h.DLogf("Shutdown of child done before local shutdown complete, signalling wg: \"%s\"", child)
-		case <-h.localShutdownDoneChan:
-			// h.DLogf("Local shutdown done, shutting down async child \"%s\"", child)
-			child.StartShutdown(h.shutdownErr)
-			err := child.WaitShutdown()
-			if err == nil {
-				// h.DLogf("Shutdown of child done, signalling wg: \"%s\"", child)
-			} else {
-				// h.DLogf("Shutdown of child done with error, signalling wg: \"%s\": %s", child, err)
-			}
-		}
-		h.wg.Done()
-	}()
-	return nil
+	h.linkChildTrace(child)
+	return reg, nil
 }
 
 // AddSyncCloseChild adds a dependent child object to the set of objects that will be
 // actively closed by this helper after StateLocalShutdown, before this
-// object's shutdown is considered complete. The child will be Close()'d in its own
-// goroutine, in parallel with shutdown and closure of other dependent children.
+// object's shutdown is considered complete. The child will be Close()'d in parallel with shutdown
+// and closure of other dependent children, subject to the limit set by SetChildShutdownParallelism.
+// The return code of the child's Close() method is ignored unless a ChildErrorPolicy other than
+// IgnoreChildErrors has been set.
+// Since the helper has no way of knowing when the child has been closed by other means, long-lived
+// helpers should use the returned ChildHandle to unregister children that are closed before the helper
+// shuts down.
+// On success, a ChildHandle is returned that can be used to unregister the child.
 // An error is returned if StateShutdown has already been reached.
-func (h *Helper) AddSyncCloseChild(child io.Closer) error {
+func (h *Helper) AddSyncCloseChild(child io.Closer) (ChildHandle, error) {
 	// h.DLogf("AddSyncCloseChild(\"%s\")", child)
 	h.Lock.Lock()
+	defer h.Lock.Unlock()
 	if h.state >= StateShutDown {
-		h.Lock.Unlock()
-		return fmt.Errorf("Cannot add shutdown child chan; StateShutdown already entered: \"%s\"", child)
+		return nil, fmt.Errorf("Cannot add shutdown child chan; StateShutdown already entered: \"%s\"", child)
 	}
-	h.wg.Add(1)
-	h.Lock.Unlock()
-	go func() {
-		<-h.localShutdownDoneChan
-		h.lg.TLogf("Local shutdown done, shutting down sync Closer child \"%s\"", child)
-		err := child.Close()
-		if err == nil {
-			h.lg.TLogf("Close of child done, signalling wg: \"%s\"", child)
-		} else {
-			h.lg.TLogf("Close of child done with error, signalling wg: \"%s\": %s", child, err)
-		}
-		h.wg.Done()
-	}()
-	return nil
+	reg := &childRegistration{h: h, closer: child}
+	h.lockedAddChild(reg)
+	return reg, nil
 }
@@ -0,0 +1,232 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// nopCloser is an io.Closer that does nothing
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// newBenchParent creates an unactivated parent helper with a trivial shutdown handler
+func newBenchParent() AsyncHelper {
+	return NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		return completionErr
+	})
+}
+
+// benchmarkRegisterChildren registers b.N children with a single parent using addChild, and reports
+// the number of goroutines and bytes of heap and stack retained per registered child. It then calls
+// release (if not nil) and shuts the parent down.
+func benchmarkRegisterChildren(b *testing.B, addChild func(parent AsyncHelper), release func()) {
+	parent := newBenchParent()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	goroutinesBefore := runtime.NumGoroutine()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addChild(parent)
+	}
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	goroutines := runtime.NumGoroutine() - goroutinesBefore
+	retained := int64(after.HeapAlloc+after.StackInuse) - int64(before.HeapAlloc+before.StackInuse)
+	b.ReportMetric(float64(goroutines)/float64(b.N), "goroutines/child")
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/child")
+	if release != nil {
+		release()
+	}
+	err := parent.Shutdown(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkAddShutdownChildChan(b *testing.B) {
+	doneChan := make(chan struct{})
+	benchmarkRegisterChildren(b, func(parent AsyncHelper) {
+		parent.AddShutdownChildChan(doneChan)
+	}, func() {
+		close(doneChan)
+	})
+}
+
+func BenchmarkAddAsyncShutdownChild(b *testing.B) {
+	child := newBenchParent()
+	benchmarkRegisterChildren(b, func(parent AsyncHelper) {
+		parent.AddAsyncShutdownChild(child)
+	}, nil)
+}
+
+func BenchmarkAddSyncCloseChild(b *testing.B) {
+	benchmarkRegisterChildren(b, func(parent AsyncHelper) {
+		parent.AddSyncCloseChild(nopCloser{})
+	}, nil)
+}
+
+func TestDoOnceActivateAfterShutdown(t *testing.T) {
+	shutdownErr := errors.New("shutdown error")
+	h := newTestHelper()
+	h.Shutdown(shutdownErr)
+	if err := h.DoOnceActivate(func() error { return nil }, true); err != shutdownErr {
+		t.Fatalf("DoOnceActivate returned %v; expected the final completion status", err)
+	}
+	if err := h.DoOnceActivate(func() error { return nil }, false); err == nil || err == shutdownErr {
+		t.Fatalf("DoOnceActivate without waitOnFail returned %v", err)
+	}
+
+	h = newTestHelper()
+	h.Shutdown(nil)
+	if err := h.DoOnceActivate(func() error { return nil }, true); err == nil {
+		t.Fatal("DoOnceActivate succeeded after shutdown")
+	}
+}
+
+// newTimeoutTestHelper creates an unactivated helper with the given shutdown timeouts, whose context-aware
+// shutdown handler is handler, and whose force shutdown handler sends its advisory completion status to the
+// returned chan.
+func newTimeoutTestHelper(
+	t *testing.T,
+	gracefulTimeout time.Duration,
+	forceTimeout time.Duration,
+	handler OnceShutdownContextHandler,
+) (*Helper, <-chan error) {
+	t.Helper()
+	h := newTestHelper()
+	if err := h.SetOnceShutdownContextHandler(handler); err != nil {
+		t.Fatalf("SetOnceShutdownContextHandler failed: %s", err)
+	}
+	forced := make(chan error, 1)
+	if err := h.SetForceShutdownHandler(func(completionErr error) { forced <- completionErr }); err != nil {
+		t.Fatalf("SetForceShutdownHandler failed: %s", err)
+	}
+	if err := h.SetShutdownTimeouts(gracefulTimeout, forceTimeout); err != nil {
+		t.Fatalf("SetShutdownTimeouts failed: %s", err)
+	}
+	return h, forced
+}
+
+func TestShutdownHandlerWithinGracefulTimeout(t *testing.T) {
+	h, forced := newTimeoutTestHelper(t, time.Hour, time.Hour, func(ctx context.Context, completionErr error) error {
+		return completionErr
+	})
+	advisoryErr := errors.New("advisory")
+	if err := h.Shutdown(advisoryErr); err != advisoryErr {
+		t.Fatalf("Shutdown returned %v; expected %v", err, advisoryErr)
+	}
+	select {
+	case <-forced:
+		t.Fatal("Force shutdown handler was called for a handler that returned in time")
+	default:
+	}
+}
+
+func TestShutdownGracefulTimeout(t *testing.T) {
+	advisoryErr := errors.New("advisory")
+	handlerErr := errors.New("handler error")
+	// forced is used by the handler, so it must be declared first
+	var forced <-chan error
+	h, forced := newTimeoutTestHelper(t, time.Millisecond, 0, func(ctx context.Context, completionErr error) error {
+		// The handler only returns once the graceful timeout has cancelled its context and the force shutdown
+		// handler has been called
+		<-ctx.Done()
+		if err := <-forced; err != advisoryErr {
+			t.Errorf("Force shutdown handler was called with %v; expected %v", err, advisoryErr)
+		}
+		return handlerErr
+	})
+	// With no force timeout, the helper waits for the handler no matter how long it takes
+	if err := h.Shutdown(advisoryErr); err != handlerErr {
+		t.Fatalf("Shutdown returned %v; expected %v", err, handlerErr)
+	}
+}
+
+func TestShutdownHandlerAbandoned(t *testing.T) {
+	release := make(chan struct{})
+	handlerErr := errors.New("handler error")
+	h, forced := newTimeoutTestHelper(t, time.Millisecond, time.Millisecond, func(ctx context.Context, completionErr error) error {
+		<-release
+		return handlerErr
+	})
+	var localShutdownErr error
+	h.AddStateObserver(func(oldState State, newState State, info TransitionInfo) {
+		if newState == StateLocalShutdown {
+			localShutdownErr = info.Err
+		}
+	})
+	if err := h.Shutdown(nil); err != ErrShutdownTimeout {
+		t.Fatalf("Shutdown returned %v; expected ErrShutdownTimeout", err)
+	}
+	if err := <-forced; err != nil {
+		t.Fatalf("Force shutdown handler was called with %v; expected nil", err)
+	}
+	h.Lock.Lock()
+	abandoned := h.isShutdownHandlerAbandoned
+	h.Lock.Unlock()
+	if !abandoned {
+		t.Fatal("Shutdown handler is not marked as abandoned")
+	}
+	if err := h.WaitLocalShutdown(); err != ErrShutdownTimeout || localShutdownErr != ErrShutdownTimeout {
+		t.Fatalf("StateLocalShutdown was entered with %v and %v; expected ErrShutdownTimeout", err, localShutdownErr)
+	}
+
+	// Once the abandoned handler returns, it is no longer tracked, and its result is ignored
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for abandoned {
+		if time.Now().After(deadline) {
+			t.Fatal("Abandoned shutdown handler is still tracked after it returned")
+		}
+		time.Sleep(time.Millisecond)
+		h.Lock.Lock()
+		abandoned = h.isShutdownHandlerAbandoned
+		h.Lock.Unlock()
+	}
+	if err := h.WaitShutdown(); err != ErrShutdownTimeout {
+		t.Fatalf("WaitShutdown returned %v after the abandoned handler returned", err)
+	}
+}
+
+func TestShutdownContextAborted(t *testing.T) {
+	h := newTestHelper()
+	// The outer deferral holds off shutdown while the bounded waits give up
+	h.DeferShutdown()
+	h.DeferShutdown()
+	shutdownErr := errors.New("shutdown error")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var abortedErr *WaitAbortedError
+	if err := h.UndeferAndShutdownContext(ctx, shutdownErr); !errors.As(err, &abortedErr) ||
+		abortedErr.State != StateUnactivated || !errors.Is(err, context.Canceled) {
+		t.Fatalf("UndeferAndShutdownContext returned %v; expected a *WaitAbortedError in StateUnactivated", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := h.WaitLocalShutdownContext(ctx); !errors.As(err, &abortedErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitLocalShutdownContext returned %v; expected a *WaitAbortedError for the deadline", err)
+	}
+	if !h.IsScheduledShutdown() {
+		t.Fatal("Shutdown was not scheduled by UndeferAndShutdownContext")
+	}
+
+	// Shutdown continues once the last deferral is released
+	h.UndeferShutdown()
+	if err := h.ShutdownContext(context.Background(), nil); err != shutdownErr {
+		t.Fatalf("ShutdownContext returned %v; expected %v", err, shutdownErr)
+	}
+	// A wait that can complete immediately succeeds even if ctx is already done
+	if err := h.WaitShutdownContext(ctx); err != shutdownErr {
+		t.Fatalf("WaitShutdownContext returned %v after shutdown; expected %v", err, shutdownErr)
+	}
+}
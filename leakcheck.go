@@ -0,0 +1,138 @@
+package asyncobj
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sammck-go/logger"
+)
+
+// LeakReport describes a Helper that was garbage collected before reaching StateShutDown.
+type LeakReport struct {
+	// Name is the name of the object, as returned by AsyncObjName at the time it was last changed
+	Name string
+
+	// State is the state of the helper when it was collected
+	State State
+
+	// Stack is the stack trace of the goroutine that created the helper
+	Stack []byte
+}
+
+// String returns a description of the leak, including the stack trace
+func (r LeakReport) String() string {
+	return fmt.Sprintf("Helper \"%s\" was garbage collected in %s without reaching StateShutDown; created at:\n%s",
+		r.Name, r.State, r.Stack)
+}
+
+// LeakHandler is a function that is called, from the finalizer goroutine, for each Helper that is garbage
+// collected before reaching StateShutDown while leak detection is enabled.
+type LeakHandler func(report LeakReport)
+
+var (
+	// leakDetection is nonzero if helpers created now should be checked for leaks
+	leakDetection int32 = boolToInt32(defaultLeakDetection)
+
+	// leakHandlerLock protects leakHandler
+	leakHandlerLock sync.Mutex
+
+	// leakHandler is called for each leaked helper, in addition to logging
+	leakHandler LeakHandler
+)
+
+// SetLeakDetection enables or disables leak detection for helpers created after it is called. When enabled,
+// the stack of the goroutine that creates each Helper is captured, and if the Helper is garbage collected
+// before it reaches StateShutDown, the leak is logged through its logger and passed to the handler set
+// with SetLeakHandler. Leak detection adds overhead to creating helpers and is intended for debugging and
+// tests. It is disabled by default, unless the package is built with the asyncobj_leakcheck build tag.
+func SetLeakDetection(enabled bool) {
+	atomic.StoreInt32(&leakDetection, boolToInt32(enabled))
+}
+
+// SetLeakHandler sets a function to be called for each leaked Helper, in addition to logging the leak.
+// Pass nil to remove the handler.
+func SetLeakHandler(handler LeakHandler) {
+	leakHandlerLock.Lock()
+	defer leakHandlerLock.Unlock()
+	leakHandler = handler
+}
+
+// leakTracker carries a finalizer that detects the garbage collection of a Helper that has not reached
+// StateShutDown. It is referenced only by its Helper and holds no reference back to it, so it becomes
+// unreachable exactly when the Helper does, even if the Helper is part of a reference cycle with the
+// object it manages (which would otherwise keep a finalizer on the Helper from ever running).
+type leakTracker struct {
+	// lock protects name and lg
+	lock sync.Mutex
+
+	// name is the name of the helper's object
+	name string
+
+	// lg is the helper's logger
+	lg logger.Logger
+
+	// state is the helper's state, updated on every transition
+	state int32
+
+	// stack is the stack trace captured when the helper was created
+	stack []byte
+}
+
+// lockedEnableLeakDetection attaches a leak tracker to a newly created helper if leak detection is enabled.
+// The lock must be held when this method is called.
+func (h *Helper) lockedEnableLeakDetection() {
+	if atomic.LoadInt32(&leakDetection) == 0 {
+		return
+	}
+	t := &leakTracker{
+		name:  h.lockedAsyncObjName(),
+		lg:    h.lg,
+		state: int32(h.state),
+		stack: debug.Stack(),
+	}
+	runtime.SetFinalizer(t, (*leakTracker).finalize)
+	h.leakTracker = t
+}
+
+// setState records a state transition of the helper
+func (t *leakTracker) setState(state State) {
+	atomic.StoreInt32(&t.state, int32(state))
+}
+
+// setName records a change to the helper's name or logger
+func (t *leakTracker) setNameAndLogger(name string, lg logger.Logger) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.name = name
+	t.lg = lg
+}
+
+// finalize reports a leak if the helper did not reach StateShutDown
+func (t *leakTracker) finalize() {
+	state := State(atomic.LoadInt32(&t.state))
+	if state >= StateShutDown {
+		return
+	}
+	t.lock.Lock()
+	report := LeakReport{Name: t.name, State: state, Stack: t.stack}
+	lg := t.lg
+	t.lock.Unlock()
+	lg.ELogf("%s", report)
+	leakHandlerLock.Lock()
+	handler := leakHandler
+	leakHandlerLock.Unlock()
+	if handler != nil {
+		handler(report)
+	}
+}
+
+// boolToInt32 converts a bool to 1 or 0
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
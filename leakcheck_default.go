@@ -0,0 +1,8 @@
+//go:build !asyncobj_leakcheck
+// +build !asyncobj_leakcheck
+
+package asyncobj
+
+// defaultLeakDetection is the initial setting of SetLeakDetection. Build with the asyncobj_leakcheck
+// tag to enable leak detection by default.
+const defaultLeakDetection = false
@@ -0,0 +1,8 @@
+//go:build asyncobj_leakcheck
+// +build asyncobj_leakcheck
+
+package asyncobj
+
+// defaultLeakDetection is the initial setting of SetLeakDetection. It is true because the package was
+// built with the asyncobj_leakcheck tag.
+const defaultLeakDetection = true
@@ -0,0 +1,54 @@
+package asyncobj
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createHelpers creates a helper that is abandoned in StateActivated, and one that is properly shut down
+func createHelpers() {
+	leaked := newTestHelper()
+	leaked.SetAsyncObjName("leaked")
+	leaked.SetIsActivated()
+	closed := newTestHelper()
+	closed.SetAsyncObjName("closed")
+	closed.Close()
+}
+
+func TestLeakDetection(t *testing.T) {
+	SetLeakDetection(true)
+	defer SetLeakDetection(defaultLeakDetection)
+	reports := make(chan LeakReport, 10)
+	SetLeakHandler(func(report LeakReport) { reports <- report })
+	defer SetLeakHandler(nil)
+
+	createHelpers()
+	// Finalizers run in the background after a collection, so keep collecting until the leak is reported
+	deadline := time.Now().Add(5 * time.Second)
+	var report LeakReport
+	for found := false; !found; {
+		if time.Now().After(deadline) {
+			t.Fatal("Leaked helper was not reported")
+		}
+		runtime.GC()
+		select {
+		case report = <-reports:
+			found = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if report.Name != "leaked" || report.State != StateActivated || !strings.Contains(string(report.Stack), "createHelpers") {
+		t.Fatalf("Unexpected leak report: %s", report)
+	}
+
+	// The helper that was shut down must never be reported
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case report = <-reports:
+		t.Fatalf("Unexpected leak report: %s", report)
+	default:
+	}
+}
@@ -0,0 +1,381 @@
+package asyncobj
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsDurationBuckets are the upper bounds, in seconds, of the buckets of the duration histograms
+// maintained by a MetricsRegistry.
+var MetricsDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// liveStates lists every State in which an object is counted by a MetricsRegistry, in order. Objects that
+// reach StateShutDown are no longer counted in a state, only in the number of objects shut down.
+var liveStates = []State{
+	StateUnactivated,
+	StateActivating,
+	StateActivated,
+	StateSuspending,
+	StateSuspended,
+	StateDraining,
+	StateShuttingDown,
+	StateLocalShutdown,
+}
+
+// durationHistogram is a cumulative histogram of durations, using MetricsDurationBuckets
+type durationHistogram struct {
+	// counts holds the number of observations in each bucket (not cumulative), with a final
+	// bucket for observations larger than the last bound
+	counts []uint64
+
+	// sum is the sum of all observations, in seconds
+	sum float64
+
+	// count is the total number of observations
+	count uint64
+}
+
+// observe records a duration in the histogram
+func (hist *durationHistogram) observe(d time.Duration) {
+	if hist.counts == nil {
+		hist.counts = make([]uint64, len(MetricsDurationBuckets)+1)
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(MetricsDurationBuckets, seconds)
+	hist.counts[i]++
+	hist.sum += seconds
+	hist.count++
+}
+
+// cumulative returns the cumulative count for each bucket bound, followed by the total count
+func (hist *durationHistogram) cumulative() []uint64 {
+	result := make([]uint64, len(MetricsDurationBuckets)+1)
+	var total uint64
+	for i := range result {
+		if hist.counts != nil {
+			total += hist.counts[i]
+		}
+		result[i] = total
+	}
+	return result
+}
+
+// kindMetrics holds the metrics for all objects of a single kind
+type kindMetrics struct {
+	// states is the number of objects in each State other than StateShutDown
+	states [StateShutDown]int64
+
+	// shutDown is the number of objects that have reached StateShutDown
+	shutDown uint64
+
+	// activationFailures is the number of activations that failed
+	activationFailures uint64
+
+	// children is the number of children currently registered or being shut down
+	children int64
+
+	// childrenAdded is the total number of children ever registered
+	childrenAdded uint64
+
+	// activation records the time from StateActivating to the end of activation
+	activation durationHistogram
+
+	// localShutdown records the time from StateShuttingDown to StateLocalShutdown
+	localShutdown durationHistogram
+
+	// shutdown records the time from StateShuttingDown to StateShutDown
+	shutdown durationHistogram
+}
+
+// MetricsRegistry collects lifecycle metrics from Helpers that report into it with SetMetricsRegistry,
+// grouped by kind: the number of live objects in each State, the number of objects shut down, histograms of activation, local shutdown and final
+// shutdown durations, the number of failed activations, and the number of registered children.
+//
+// The metrics can be published with expvar (a MetricsRegistry is an expvar.Var) or written in the OpenMetrics
+// text format with WriteOpenMetrics. A MetricsRegistry is safe for concurrent use. It holds no reference to
+// the objects that report into it, and once an object reaches StateShutDown it is only reflected in the
+// aggregate counters and histograms, so the registry does not grow as objects come and go.
+type MetricsRegistry struct {
+	// lock protects kinds
+	lock sync.Mutex
+
+	// kinds holds the metrics for each kind of object
+	kinds map[string]*kindMetrics
+}
+
+// NewMetricsRegistry creates a new, empty MetricsRegistry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{kinds: make(map[string]*kindMetrics)}
+}
+
+// lockedKind returns the metrics for a kind of object, creating them if necessary.
+// The lock must be held when this method is called.
+func (r *MetricsRegistry) lockedKind(kind string) *kindMetrics {
+	km := r.kinds[kind]
+	if km == nil {
+		km = &kindMetrics{}
+		r.kinds[kind] = km
+	}
+	return km
+}
+
+// addObject counts a new object in its initial state
+func (r *MetricsRegistry) addObject(kind string, state State) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lockedKind(kind).states[state]++
+}
+
+// transition records a state transition of an object. activationTime and shutdownTime are the times
+// at which StateActivating and StateShuttingDown were entered, or zero if they have not been.
+func (r *MetricsRegistry) transition(
+	kind string,
+	oldState State,
+	newState State,
+	now time.Time,
+	activationTime time.Time,
+	shutdownTime time.Time,
+) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	km := r.lockedKind(kind)
+	km.states[oldState]--
+	if newState == StateShutDown {
+		km.shutDown++
+	} else {
+		km.states[newState]++
+	}
+	if oldState == StateActivating {
+		km.activation.observe(now.Sub(activationTime))
+		if newState != StateActivated {
+			km.activationFailures++
+		}
+	}
+	switch newState {
+	case StateLocalShutdown:
+		km.localShutdown.observe(now.Sub(shutdownTime))
+	case StateShutDown:
+		km.shutdown.observe(now.Sub(shutdownTime))
+	}
+}
+
+// childrenChanged adjusts the number of registered children of an object
+func (r *MetricsRegistry) childrenChanged(kind string, delta int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	km := r.lockedKind(kind)
+	km.children += int64(delta)
+	if delta > 0 {
+		km.childrenAdded += uint64(delta)
+	}
+}
+
+// lockedSortedKinds returns the names of all kinds, sorted. The lock must be held when this method is called.
+func (r *MetricsRegistry) lockedSortedKinds() []string {
+	kinds := make([]string, 0, len(r.kinds))
+	for kind := range r.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// histogramJSON is the expvar representation of a duration histogram
+type histogramJSON struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+// kindJSON is the expvar representation of the metrics for a kind of object
+type kindJSON struct {
+	States                    map[string]int64 `json:"states"`
+	ShutDown                  uint64           `json:"shut_down"`
+	ActivationFailures        uint64           `json:"activation_failures"`
+	Children                  int64            `json:"children"`
+	ChildrenAdded             uint64           `json:"children_added"`
+	ActivationDurationSeconds histogramJSON    `json:"activation_duration_seconds"`
+	LocalShutdownSeconds      histogramJSON    `json:"local_shutdown_duration_seconds"`
+	ShutdownSeconds           histogramJSON    `json:"shutdown_duration_seconds"`
+}
+
+// toJSON converts a histogram to its expvar representation
+func (hist *durationHistogram) toJSON() histogramJSON {
+	cumulative := hist.cumulative()
+	buckets := make(map[string]uint64, len(cumulative))
+	for i, bound := range MetricsDurationBuckets {
+		buckets[formatBound(bound)] = cumulative[i]
+	}
+	buckets["+Inf"] = cumulative[len(MetricsDurationBuckets)]
+	return histogramJSON{Count: hist.count, Sum: hist.sum, Buckets: buckets}
+}
+
+// String returns the metrics as a JSON object keyed by kind, implementing expvar.Var
+func (r *MetricsRegistry) String() string {
+	r.lock.Lock()
+	result := make(map[string]kindJSON, len(r.kinds))
+	for kind, km := range r.kinds {
+		states := make(map[string]int64, len(liveStates))
+		for _, state := range liveStates {
+			states[state.String()] = km.states[state]
+		}
+		result[kind] = kindJSON{
+			States:                    states,
+			ShutDown:                  km.shutDown,
+			ActivationFailures:        km.activationFailures,
+			Children:                  km.children,
+			ChildrenAdded:             km.childrenAdded,
+			ActivationDurationSeconds: km.activation.toJSON(),
+			LocalShutdownSeconds:      km.localShutdown.toJSON(),
+			ShutdownSeconds:           km.shutdown.toJSON(),
+		}
+	}
+	r.lock.Unlock()
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// Publish publishes the registry with expvar under name. Like expvar.Publish, it panics if name is
+// already in use.
+func (r *MetricsRegistry) Publish(name string) {
+	expvar.Publish(name, r)
+}
+
+// WriteOpenMetrics writes the metrics to w in the OpenMetrics text exposition format, terminated with "# EOF".
+func (r *MetricsRegistry) WriteOpenMetrics(w io.Writer) error {
+	var b strings.Builder
+	r.lock.Lock()
+	kinds := r.lockedSortedKinds()
+
+	b.WriteString("# TYPE asyncobj_objects gauge\n")
+	b.WriteString("# HELP asyncobj_objects Number of objects in each lifecycle state, other than ShutDown.\n")
+	for _, kind := range kinds {
+		for _, state := range liveStates {
+			fmt.Fprintf(&b, "asyncobj_objects{kind=\"%s\",state=\"%s\"} %d\n",
+				escapeLabel(kind), state, r.kinds[kind].states[state])
+		}
+	}
+
+	b.WriteString("# TYPE asyncobj_objects_shut_down counter\n")
+	b.WriteString("# HELP asyncobj_objects_shut_down Number of objects that have finished shutting down.\n")
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "asyncobj_objects_shut_down_total{kind=\"%s\"} %d\n", escapeLabel(kind), r.kinds[kind].shutDown)
+	}
+
+	b.WriteString("# TYPE asyncobj_activation_failures counter\n")
+	b.WriteString("# HELP asyncobj_activation_failures Number of activations that failed.\n")
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "asyncobj_activation_failures_total{kind=\"%s\"} %d\n", escapeLabel(kind), r.kinds[kind].activationFailures)
+	}
+
+	b.WriteString("# TYPE asyncobj_children gauge\n")
+	b.WriteString("# HELP asyncobj_children Number of children registered or being shut down.\n")
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "asyncobj_children{kind=\"%s\"} %d\n", escapeLabel(kind), r.kinds[kind].children)
+	}
+
+	b.WriteString("# TYPE asyncobj_children_added counter\n")
+	b.WriteString("# HELP asyncobj_children_added Number of children ever registered.\n")
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "asyncobj_children_added_total{kind=\"%s\"} %d\n", escapeLabel(kind), r.kinds[kind].childrenAdded)
+	}
+
+	writeHistogram := func(name string, help string, get func(km *kindMetrics) *durationHistogram) {
+		fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+		fmt.Fprintf(&b, "# UNIT %s seconds\n", name)
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		for _, kind := range kinds {
+			hist := get(r.kinds[kind])
+			cumulative := hist.cumulative()
+			label := escapeLabel(kind)
+			for i, bound := range MetricsDurationBuckets {
+				fmt.Fprintf(&b, "%s_bucket{kind=\"%s\",le=\"%s\"} %d\n", name, label, formatBound(bound), cumulative[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket{kind=\"%s\",le=\"+Inf\"} %d\n", name, label, cumulative[len(MetricsDurationBuckets)])
+			fmt.Fprintf(&b, "%s_sum{kind=\"%s\"} %s\n", name, label, strconv.FormatFloat(hist.sum, 'g', -1, 64))
+			fmt.Fprintf(&b, "%s_count{kind=\"%s\"} %d\n", name, label, hist.count)
+		}
+	}
+	writeHistogram("asyncobj_activation_duration_seconds", "Time spent in StateActivating.",
+		func(km *kindMetrics) *durationHistogram { return &km.activation })
+	writeHistogram("asyncobj_local_shutdown_duration_seconds", "Time from StateShuttingDown to StateLocalShutdown.",
+		func(km *kindMetrics) *durationHistogram { return &km.localShutdown })
+	writeHistogram("asyncobj_shutdown_duration_seconds", "Time from StateShuttingDown to StateShutDown.",
+		func(km *kindMetrics) *durationHistogram { return &km.shutdown })
+	r.lock.Unlock()
+
+	b.WriteString("# EOF\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatBound formats a histogram bucket bound for use as a label value
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+// labelEscaper escapes label values in the OpenMetrics text format
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// escapeLabel escapes a label value in the OpenMetrics text format
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// SetMetricsRegistry causes the helper to report its lifecycle metrics into registry, grouped with other
+// objects of the same kind. If kind is empty, the type name of the managed object is used.
+// Cannot be called after activation or shutdown has started, or more than once.
+func (h *Helper) SetMetricsRegistry(registry *MetricsRegistry, kind string) error {
+	h.Lock.Lock()
+	if h.state != StateUnactivated || h.isScheduledShutdown {
+		h.Lock.Unlock()
+		return errors.New("Cannot SetMetricsRegistry after activation or shutdown has started")
+	}
+	if h.metrics != nil {
+		h.Lock.Unlock()
+		return errors.New("Cannot SetMetricsRegistry more than once")
+	}
+	if kind == "" {
+		if h.obj != nil {
+			kind = fmt.Sprintf("%T", h.obj)
+		} else {
+			kind = fmt.Sprintf("%T", h)
+		}
+	}
+	defer h.Lock.Unlock()
+	h.metrics = registry
+	h.metricsKind = kind
+	registry.addObject(kind, h.state)
+	h.metricsChildrenChanged(len(h.children))
+
+	// Transitions are delivered to observers one at a time, so these need no locking
+	var activationTime, shutdownTime time.Time
+	h.lockedAddStateObserver(func(oldState State, newState State, info TransitionInfo) {
+		switch newState {
+		case StateActivating:
+			activationTime = info.Time
+		case StateShuttingDown:
+			shutdownTime = info.Time
+		}
+		registry.transition(kind, oldState, newState, info.Time, activationTime, shutdownTime)
+	})
+	return nil
+}
+
+// metricsChildrenChanged reports a change in the number of registered children, if metrics are enabled.
+func (h *Helper) metricsChildrenChanged(delta int) {
+	if h.metrics != nil && delta != 0 {
+		h.metrics.childrenChanged(h.metricsKind, delta)
+	}
+}
@@ -0,0 +1,95 @@
+package asyncobj
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMetricsTestHelper creates a helper that reports into registry, and a chan that is closed once the
+// registry has seen the helper reach StateShutDown
+func newMetricsTestHelper(t *testing.T, registry *MetricsRegistry) (*Helper, <-chan struct{}) {
+	t.Helper()
+	h := newTestHelper()
+	if err := h.SetMetricsRegistry(registry, "test"); err != nil {
+		t.Fatalf("SetMetricsRegistry failed: %s", err)
+	}
+	// Observers are called in registration order, so the registry has been updated when this one is called
+	shutDown := make(chan struct{})
+	h.AddStateObserver(func(oldState State, newState State, info TransitionInfo) {
+		if newState == StateShutDown {
+			close(shutDown)
+		}
+	})
+	return h, shutDown
+}
+
+func TestMetricsOpenMetrics(t *testing.T) {
+	registry := NewMetricsRegistry()
+	activated, _ := newMetricsTestHelper(t, registry)
+	if err := activated.DoOnceActivate(func() error { return nil }, true); err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+	activated.AddShutdownChildChan(make(chan struct{}))
+	failed, failedShutDown := newMetricsTestHelper(t, registry)
+	failed.DoOnceActivate(func() error { return errors.New("activation failed") }, true)
+	<-failedShutDown
+	newMetricsTestHelper(t, registry)
+
+	var b strings.Builder
+	if err := registry.WriteOpenMetrics(&b); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %s", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE asyncobj_objects gauge\n",
+		"asyncobj_objects{kind=\"test\",state=\"StateUnactivated\"} 1\n",
+		"asyncobj_objects{kind=\"test\",state=\"StateActivated\"} 1\n",
+		"asyncobj_objects{kind=\"test\",state=\"StateShuttingDown\"} 0\n",
+		"asyncobj_objects_shut_down_total{kind=\"test\"} 1\n",
+		"asyncobj_activation_failures_total{kind=\"test\"} 1\n",
+		"asyncobj_children{kind=\"test\"} 1\n",
+		"asyncobj_children_added_total{kind=\"test\"} 1\n",
+		"# UNIT asyncobj_activation_duration_seconds seconds\n",
+		"asyncobj_activation_duration_seconds_bucket{kind=\"test\",le=\"+Inf\"} 2\n",
+		"asyncobj_activation_duration_seconds_count{kind=\"test\"} 2\n",
+		"asyncobj_shutdown_duration_seconds_count{kind=\"test\"} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("OpenMetrics output does not contain %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Fatalf("OpenMetrics output is not terminated with # EOF:\n%s", out)
+	}
+	if strings.Contains(out, "state=\"StateShutDown\"") {
+		t.Fatalf("OpenMetrics output counts objects in StateShutDown:\n%s", out)
+	}
+}
+
+func TestMetricsShutDownObjects(t *testing.T) {
+	registry := NewMetricsRegistry()
+	for i := 0; i < 3; i++ {
+		h, shutDown := newMetricsTestHelper(t, registry)
+		h.DoOnceActivate(func() error { return nil }, true)
+		h.Close()
+		select {
+		case <-shutDown:
+		case <-time.After(5 * time.Second):
+			t.Fatal("StateShutDown was not delivered to observers")
+		}
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	km := registry.kinds["test"]
+	for _, state := range liveStates {
+		if km.states[state] != 0 {
+			t.Fatalf("%d objects are counted in %s after all have shut down", km.states[state], state)
+		}
+	}
+	if km.shutDown != 3 || km.shutdown.count != 3 {
+		t.Fatalf("%d objects shut down and %d shutdown durations recorded; expected 3", km.shutDown, km.shutdown.count)
+	}
+}
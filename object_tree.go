@@ -0,0 +1,98 @@
+package asyncobj
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ObjectTreeNode is a snapshot of an object and its registered children, used for diagnostics.
+type ObjectTreeNode struct {
+	// Name is the name of the object (see AsyncObjName)
+	Name string
+
+	// HasState is true if the object is managed by a Helper, in which case State, Phase and Goroutines are valid
+	HasState bool
+
+	// State is the state of the object
+	State State
+
+	// Phase describes what the object is waiting for if it is shutting down, or is empty
+	Phase string
+
+	// Goroutines contains the names of goroutines started with Go that have not yet returned, and of the
+	// shutdown handler if it has been abandoned (see SetShutdownTimeouts) but is still running
+	Goroutines []string
+
+	// Children contains the object's registered children that have not yet finished
+	Children []ObjectTreeNode
+}
+
+// String returns a multi-line, indented description of the tree
+func (n ObjectTreeNode) String() string {
+	var b strings.Builder
+	n.write(&b, "")
+	return b.String()
+}
+
+// write appends the description of the tree to b, with each line prefixed by indent
+func (n ObjectTreeNode) write(b *strings.Builder, indent string) {
+	b.WriteString(indent)
+	b.WriteString(n.Name)
+	if n.HasState {
+		fmt.Fprintf(b, " [%s]", n.State)
+		if n.Phase != "" {
+			fmt.Fprintf(b, " %s", n.Phase)
+		}
+		if len(n.Goroutines) > 0 {
+			fmt.Fprintf(b, " goroutines: %s", strings.Join(n.Goroutines, ", "))
+		}
+	}
+	b.WriteString("\n")
+	for _, child := range n.Children {
+		child.write(b, indent+"  ")
+	}
+}
+
+// objectTreer is implemented by objects that can describe their own subtree, including *Helper and all
+// objects that embed one.
+type objectTreer interface {
+	ObjectTree() ObjectTreeNode
+}
+
+// ObjectTree returns a snapshot of the object, its state, and the tree of its registered children that
+// have not yet finished. Children that embed a *Helper are described recursively.
+func (h *Helper) ObjectTree() ObjectTreeNode {
+	h.Lock.Lock()
+	node := ObjectTreeNode{
+		Name:     h.lockedAsyncObjName(),
+		HasState: true,
+		State:    h.state,
+	}
+	if h.lockedIsStartedShutdown() && h.state < StateShutDown {
+		node.Phase = h.shutdownPhase
+	}
+	abandoned := h.isShutdownHandlerAbandoned
+	children := make([]*childRegistration, 0, len(h.children)+len(h.pendingChildren))
+	children = append(children, h.children...)
+	for reg := range h.pendingChildren {
+		children = append(children, reg)
+	}
+	h.Lock.Unlock()
+	node.Goroutines = h.RunningGoroutines()
+	if abandoned {
+		node.Goroutines = append(node.Goroutines, abandonedShutdownHandlerName)
+	}
+
+	// Children are described without holding the lock, since they may have to lock themselves
+	for _, reg := range children {
+		if reg.isDone() {
+			continue
+		}
+		if treer, ok := reg.asyncChild.(objectTreer); ok {
+			node.Children = append(node.Children, treer.ObjectTree())
+		} else {
+			node.Children = append(node.Children, ObjectTreeNode{Name: reg.describe()})
+		}
+	}
+	return node
+}
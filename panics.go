@@ -0,0 +1,62 @@
+package asyncobj
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error produced when a Helper with panic recovery enabled recovers a panic in
+// an activation callback, shutdown handler, child shutdown, or goroutine started with Go. It is used as
+// the activation error or completion status in place of the value that would have been returned, so
+// the state machine still reaches StateShutDown and parents see a proper failure.
+type PanicError struct {
+	// Value is the value that was passed to panic()
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine, as returned by runtime/debug.Stack()
+	Stack []byte
+}
+
+// Error returns a description of the panic, without the stack trace
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Recovered panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, or nil otherwise
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// SetRecoverPanics determines whether panics in the activation callback, shutdown handlers, children's
+// Close() and StartShutdown() methods called during shutdown, and functions run with Go are recovered and
+// converted to a *PanicError, which is then used as the activation error or completion status. Panics in
+// health checks, including those of children checked by CheckHealth, are reported as Unhealthy, and
+// panics in state observers are logged and otherwise ignored.
+// It is disabled by default, in which case such panics crash the process as usual.
+func (h *Helper) SetRecoverPanics(enabled bool) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	h.recoverPanics = enabled
+}
+
+// callRecovering calls fn and returns its result. If panic recovery is enabled and fn panics, the
+// panic is logged and returned as a *PanicError. what describes fn for logging.
+func (h *Helper) callRecovering(what string, fn func() error) (err error) {
+	h.Lock.Lock()
+	recoverPanics := h.recoverPanics
+	h.Lock.Unlock()
+	if !recoverPanics {
+		return fn()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			h.lg.ELogf("Recovered panic in %s: %v\n%s", what, r, panicErr.Stack)
+			err = panicErr
+		}
+	}()
+	return fn()
+}
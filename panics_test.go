@@ -0,0 +1,66 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// panickingCloser is an io.Closer that panics
+type panickingCloser struct{}
+
+func (panickingCloser) Close() error {
+	panic("close panic")
+}
+
+// checkPanicError fails the test if err is not a *PanicError for value
+func checkPanicError(t *testing.T, err error, value interface{}) {
+	t.Helper()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Got %v; expected a *PanicError", err)
+	}
+	if panicErr.Value != value || len(panicErr.Stack) == 0 {
+		t.Fatalf("PanicError has value %v and %d bytes of stack; expected %v and a stack", panicErr.Value, len(panicErr.Stack), value)
+	}
+}
+
+func TestPanicInActivationCallback(t *testing.T) {
+	h := newTestHelper()
+	h.SetRecoverPanics(true)
+	activateErr := errors.New("activation panic")
+	err := h.DoOnceActivate(func() error { panic(activateErr) }, true)
+	checkPanicError(t, err, activateErr)
+	if !errors.Is(err, activateErr) {
+		t.Fatal("PanicError does not unwrap to the error passed to panic()")
+	}
+	if state := h.GetAsyncObjState(); state != StateShutDown {
+		t.Fatalf("State is %s after a panicking activation; expected StateShutDown", state)
+	}
+}
+
+func TestPanicInShutdownHandler(t *testing.T) {
+	h := NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		panic("shutdown panic")
+	})
+	h.(*Helper).SetRecoverPanics(true)
+	checkPanicError(t, h.Shutdown(nil), "shutdown panic")
+}
+
+func TestPanicInChildClose(t *testing.T) {
+	h := newTestHelper()
+	h.SetRecoverPanics(true)
+	h.SetChildErrorPolicy(FirstChildError)
+	h.AddSyncCloseChild(panickingCloser{})
+	checkPanicError(t, h.Shutdown(nil), "close panic")
+}
+
+func TestPanicInGo(t *testing.T) {
+	h := newTestHelper()
+	h.SetRecoverPanics(true)
+	h.Go("panicking", func(ctx context.Context) error {
+		panic("goroutine panic")
+	})
+	// A recovered panic starts shutdown even though SetShutdownOnGoError has not been called
+	checkPanicError(t, h.WaitShutdown(), "goroutine panic")
+}
@@ -0,0 +1,139 @@
+package asyncobj
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ExitCoder may be implemented by errors that determine the process exit code when they are the final
+// completion status of the root object passed to RunMain.
+type ExitCoder interface {
+	// ExitCode returns the process exit code for the error
+	ExitCode() int
+}
+
+// DefaultDeadlineExitCode is the exit code used by Run when the root object does not finish shutting down
+// before the hard deadline, if RunOptions.DeadlineExitCode is 0.
+const DefaultDeadlineExitCode = 3
+
+// Runnable is the interface required of the root object passed to Run and RunMain. It is implemented by
+// *Helper and by all objects that embed one.
+type Runnable interface {
+	AsyncHelper
+
+	// ShutdownOnSignals is used to start shutdown when one of RunOptions.Signals is received
+	ShutdownOnSignals(sigs ...os.Signal)
+
+	// DrainingChan is used to arm RunOptions.ShutdownDeadline as soon as shutdown is scheduled
+	DrainingChan() <-chan struct{}
+
+	// ObjectTree is used to report the objects still running if RunOptions.ShutdownDeadline expires
+	ObjectTree() ObjectTreeNode
+}
+
+// RunOptions configures Run and RunMain. The zero value is usable.
+type RunOptions struct {
+	// Activate is the activation callback passed to DoOnceActivate. If nil, the root object must implement
+	// HandleOnceActivator or HandleOnceActivatorContext.
+	Activate OnceActivateCallback
+
+	// Signals are the signals that start shutdown of the root object (see ShutdownOnSignals). If nil,
+	// os.Interrupt and syscall.SIGTERM are used.
+	Signals []os.Signal
+
+	// NoSignals disables signal handling, for when the caller handles signals itself.
+	NoSignals bool
+
+	// ExitCode maps the final completion status of the root object to the process exit code. If nil,
+	// DefaultExitCode is used.
+	ExitCode func(err error) int
+
+	// ShutdownDeadline is the longest time to wait for the root object to finish shutting down once
+	// shutdown has been scheduled (see DrainingChan), including any time spent deferred or draining. If it expires, the tree of objects that have not finished is written to DumpOutput
+	// along with the stacks of all goroutines, and Run returns DeadlineExitCode. 0 means no limit.
+	ShutdownDeadline time.Duration
+
+	// DeadlineExitCode is the exit code returned if ShutdownDeadline expires. If 0, DefaultDeadlineExitCode is used.
+	DeadlineExitCode int
+
+	// DumpOutput is where the object tree is written if ShutdownDeadline expires. If nil, os.Stderr is used.
+	DumpOutput io.Writer
+}
+
+// DefaultExitCode is the default mapping from the final completion status of the root object to the process
+// exit code: 0 for nil; the error's ExitCode() if it is or wraps an ExitCoder; 0 if shutdown was started by a
+// signal (a normal way to stop a daemon); and 1 for any other error.
+func DefaultExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitCoder ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+	var signalErr *SignalError
+	if errors.As(err, &signalErr) {
+		return 0
+	}
+	return 1
+}
+
+// Run is the testable body of RunMain. It activates root, starts shutdown when one of the configured signals
+// is received, waits for shutdown to complete, and returns the process exit code determined by the final
+// completion status. If opts is nil, default options are used.
+func Run(root Runnable, opts *RunOptions) int {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+	exitCode := opts.ExitCode
+	if exitCode == nil {
+		exitCode = DefaultExitCode
+	}
+
+	if !opts.NoSignals {
+		root.ShutdownOnSignals(opts.Signals...)
+	}
+
+	err := root.DoOnceActivate(opts.Activate, false)
+	if err != nil {
+		root.Lg().ELogf("Activation failed: %s", err)
+	}
+
+	// DrainingChan is the first sign of shutdown, so the deadline also covers deferral and draining
+	<-root.DrainingChan()
+	if opts.ShutdownDeadline > 0 {
+		timer := time.NewTimer(opts.ShutdownDeadline)
+		defer timer.Stop()
+		select {
+		case <-root.ShutdownDoneChan():
+		case <-timer.C:
+			return runDeadlineExpired(root, opts)
+		}
+	}
+	return exitCode(root.WaitShutdown())
+}
+
+// runDeadlineExpired reports a root object that did not shut down before the hard deadline, and returns
+// the exit code to use.
+func runDeadlineExpired(root Runnable, opts *RunOptions) int {
+	root.Lg().ELogf("Shutdown did not complete within %s; exiting", opts.ShutdownDeadline)
+	out := opts.DumpOutput
+	if out == nil {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "Shutdown did not complete within %s. Objects still running:\n%s\nGoroutines:\n%s\n",
+		opts.ShutdownDeadline, root.ObjectTree(), goroutineDump())
+	if opts.DeadlineExitCode != 0 {
+		return opts.DeadlineExitCode
+	}
+	return DefaultDeadlineExitCode
+}
+
+// RunMain is a complete process entry point for a root object: it calls Run and then exits the process
+// with the resulting exit code. It does not return.
+func RunMain(root Runnable, opts *RunOptions) {
+	os.Exit(Run(root, opts))
+}
@@ -0,0 +1,91 @@
+package asyncobj
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exitCodeError is an error with an exit code
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", int(e))
+}
+
+func (e exitCodeError) ExitCode() int {
+	return int(e)
+}
+
+func TestDefaultExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("failed"), 1},
+		{exitCodeError(7), 7},
+		{fmt.Errorf("wrapped: %w", exitCodeError(7)), 7},
+		{&SignalError{Signal: os.Interrupt}, 0},
+	}
+	for _, test := range tests {
+		if got := DefaultExitCode(test.err); got != test.want {
+			t.Fatalf("DefaultExitCode(%v) returned %d; expected %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRunActivationFailure(t *testing.T) {
+	code := Run(newTestHelper(), &RunOptions{
+		Activate:  func() error { return exitCodeError(7) },
+		NoSignals: true,
+	})
+	if code != 7 {
+		t.Fatalf("Run returned %d; expected the activation error's exit code 7", code)
+	}
+}
+
+func TestRunSignal(t *testing.T) {
+	code := Run(newTestHelper(), &RunOptions{
+		Activate: func() error {
+			raiseSignal(t, testSignal)
+			return nil
+		},
+		Signals: []os.Signal{testSignal},
+		ExitCode: func(err error) int {
+			if _, ok := err.(*SignalError); !ok {
+				t.Errorf("Root object shut down with %v; expected a *SignalError", err)
+			}
+			return 5
+		},
+	})
+	if code != 5 {
+		t.Fatalf("Run returned %d; expected the mapped exit code 5", code)
+	}
+}
+
+func TestRunShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	root := NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+		<-release
+		return completionErr
+	}).(*Helper)
+	root.SetAsyncObjName("stuck root")
+	var dump strings.Builder
+	code := Run(root, &RunOptions{
+		Activate:         func() error { return errors.New("activation failed") },
+		NoSignals:        true,
+		ShutdownDeadline: time.Millisecond,
+		DumpOutput:       &dump,
+	})
+	if code != DefaultDeadlineExitCode {
+		t.Fatalf("Run returned %d; expected DefaultDeadlineExitCode", code)
+	}
+	if out := dump.String(); !strings.Contains(out, "Objects still running") || !strings.Contains(out, "stuck root") {
+		t.Fatalf("Unexpected dump of the objects still running:\n%s", out)
+	}
+}
@@ -0,0 +1,123 @@
+package asyncobj
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalError is the advisory completion status used when shutdown is started by a signal received by
+// ShutdownOnSignals.
+type SignalError struct {
+	// Signal is the signal that was received
+	Signal os.Signal
+}
+
+// Error returns a description of the signal
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("Received signal: %s", e.Signal)
+}
+
+// SignalEscalation determines what ShutdownOnSignals does when a signal arrives after shutdown has started.
+type SignalEscalation int
+
+const (
+	// EscalateForceShutdown cancels the shutdown handler's context and invokes the force shutdown handler
+	// (see SetForceShutdownHandler), as if the graceful shutdown deadline had expired. If the shutdown handler
+	// has not started yet, draining is cut short instead (see Enter). This is the default.
+	EscalateForceShutdown SignalEscalation = iota
+
+	// EscalateExit immediately terminates the process with os.Exit, using the exit code configured with
+	// SetSignalEscalation.
+	EscalateExit
+
+	// EscalateNone ignores signals after shutdown has started. Signal delivery stops as soon as shutdown starts.
+	EscalateNone
+)
+
+// String returns a human-readable name for a SignalEscalation
+func (e SignalEscalation) String() string {
+	switch e {
+	case EscalateForceShutdown:
+		return "EscalateForceShutdown"
+	case EscalateExit:
+		return "EscalateExit"
+	case EscalateNone:
+		return "EscalateNone"
+	}
+	return fmt.Sprintf("SignalEscalation(%d)", int(e))
+}
+
+// osExit is os.Exit, replaceable for testing
+var osExit = os.Exit
+
+// SetSignalEscalation determines what ShutdownOnSignals does when a signal arrives after shutdown has
+// started. exitCode is the process exit code used with EscalateExit. The default is EscalateForceShutdown.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetSignalEscalation(escalation SignalEscalation, exitCode int) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetSignalEscalation after shutdown has started")
+	}
+	h.signalEscalation = escalation
+	h.signalExitCode = exitCode
+	return nil
+}
+
+// ShutdownOnSignals begins listening for the given signals (os.Interrupt and syscall.SIGTERM if none are
+// given), and starts shutdown with a *SignalError as the advisory completion status when one arrives. This
+// method does not block.
+//
+// If another signal arrives after shutdown has been scheduled (whether or not it was started by a signal, and
+// including while shutdown is deferred or draining), it is escalated as configured with SetSignalEscalation.
+// With EscalateForceShutdown, a signal that arrives before the shutdown handler has started cuts draining
+// short, and a further signal forces the shutdown handler.
+//
+// With EscalateNone, the signal.Notify registration is released as soon as shutdown starts. Otherwise it is
+// deliberately kept until escalation is finished or shutdown is complete, because releasing it restores the
+// default disposition of the signals: a second os.Interrupt or SIGTERM would then terminate the process at
+// once, bypassing both the configured escalation and the remainder of the graceful shutdown.
+func (h *Helper) ShutdownOnSignals(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, sigs...)
+	go func() {
+		defer signal.Stop(sigChan)
+		select {
+		case <-h.drainingChan:
+		case sig := <-sigChan:
+			h.lg.DLogf("Received signal %s; shutting down", sig)
+			h.StartShutdown(&SignalError{Signal: sig})
+		}
+
+		h.Lock.Lock()
+		escalation := h.signalEscalation
+		exitCode := h.signalExitCode
+		h.Lock.Unlock()
+		if escalation == EscalateNone {
+			return
+		}
+
+		for {
+			select {
+			case <-h.shutdownDoneChan:
+				return
+			case sig := <-sigChan:
+				if escalation == EscalateExit {
+					h.lg.WLogf("Received signal %s during shutdown; exiting with code %d", sig, exitCode)
+					osExit(exitCode)
+					return
+				}
+				h.lg.WLogf("Received signal %s during shutdown; forcing shutdown", sig)
+				if h.forceShutdown() {
+					return
+				}
+			}
+		}
+	}()
+}
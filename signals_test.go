@@ -0,0 +1,83 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testSignal is the signal used by these tests. It is not os.Interrupt, so that a test that fails to
+// catch it does not look like a user interrupt.
+var testSignal os.Signal = syscall.SIGHUP
+
+// raiseSignal sends sig to the current process, skipping the test if that is not supported on this platform
+func raiseSignal(t *testing.T, sig os.Signal) {
+	t.Helper()
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		t.Skipf("Cannot send %s to the current process: %s", sig, err)
+	}
+}
+
+func TestShutdownOnSignalsEscalateForceShutdown(t *testing.T) {
+	started := make(chan struct{})
+	forced := make(chan error, 1)
+	h := newTestHelper()
+	h.SetOnceShutdownContextHandler(func(ctx context.Context, completionErr error) error {
+		close(started)
+		<-ctx.Done()
+		return completionErr
+	})
+	h.SetForceShutdownHandler(func(completionErr error) { forced <- completionErr })
+	h.ShutdownOnSignals(testSignal)
+
+	raiseSignal(t, testSignal)
+	<-started
+	// The shutdown handler is running, so the second signal forces it
+	raiseSignal(t, testSignal)
+	var signalErr *SignalError
+	if err := h.WaitShutdown(); !errors.As(err, &signalErr) || signalErr.Signal != testSignal {
+		t.Fatalf("WaitShutdown returned %v; expected a *SignalError for %s", err, testSignal)
+	}
+	if err := <-forced; err != signalErr {
+		t.Fatalf("Force shutdown handler was called with %v; expected %v", err, signalErr)
+	}
+}
+
+func TestShutdownOnSignalsEscalateExit(t *testing.T) {
+	exitCodes := make(chan int, 1)
+	osExit = func(code int) { exitCodes <- code }
+	defer func() { osExit = os.Exit }()
+
+	h := newTestHelper()
+	if err := h.SetSignalEscalation(EscalateExit, 3); err != nil {
+		t.Fatalf("SetSignalEscalation failed: %s", err)
+	}
+	// Shutdown is held off until the test is done, so that the second signal arrives during shutdown
+	if err := h.DeferShutdown(); err != nil {
+		t.Fatalf("DeferShutdown failed: %s", err)
+	}
+	h.ShutdownOnSignals(testSignal)
+
+	raiseSignal(t, testSignal)
+	<-h.DrainingChan()
+	raiseSignal(t, testSignal)
+	select {
+	case code := <-exitCodes:
+		if code != 3 {
+			t.Fatalf("Process exited with code %d; expected 3", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Second signal did not exit the process")
+	}
+	h.UndeferShutdown()
+	if err := h.WaitShutdown(); err == nil {
+		t.Fatal("WaitShutdown returned nil; expected a *SignalError")
+	}
+}
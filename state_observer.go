@@ -0,0 +1,129 @@
+package asyncobj
+
+import (
+	"time"
+)
+
+// TransitionInfo carries details about a single state transition of a Helper.
+type TransitionInfo struct {
+	// Time is the time at which the transition occurred
+	Time time.Time
+
+	// Err is the completion status associated with the transition. On entry to StateDraining and
+	// StateShuttingDown it is the advisory completion status (for a failed activation, this is the activation error). On entry
+	// to StateLocalShutdown and StateShutDown it is the final completion status. It is nil for other states.
+	Err error
+}
+
+// StateObserver is a function that is called for each state transition of a Helper. Observers are called
+// in registration order, and transitions are delivered to them in the order they occurred, one at a time.
+// Observers are called without the Helper's lock held, so they may call Helper methods; however, they
+// are not synchronized with the Helper's notification channels, and transitions caused by an observer
+// are delivered only after the current observer call returns. Observers should return quickly. If panic
+// recovery is enabled (see SetRecoverPanics), a panicking observer is logged and the transition is still
+// delivered to the remaining observers.
+type StateObserver func(oldState State, newState State, info TransitionInfo)
+
+// stateObserverEntry is a registration record for a StateObserver. A pointer to it serves as the
+// identity of the registration.
+type stateObserverEntry struct {
+	observer StateObserver
+}
+
+// stateTransition is a state transition waiting to be delivered to observers.
+type stateTransition struct {
+	oldState State
+	newState State
+	info     TransitionInfo
+}
+
+// AddStateObserver registers a function that will be called, in order, for every subsequent state
+// transition of the helper, including the transition directly from StateActivating to StateShuttingDown
+// when activation fails. It returns a function that unregisters the observer; it is safe to call
+// the returned function more than once. A transition that is already being delivered when the observer
+// is unregistered may still be delivered to it.
+func (h *Helper) AddStateObserver(observer StateObserver) (unregister func()) {
+	h.Lock.Lock()
+	entry := h.lockedAddStateObserver(observer)
+	h.Lock.Unlock()
+
+	return func() {
+		h.Lock.Lock()
+		defer h.Lock.Unlock()
+		for i, e := range h.stateObservers {
+			if e == entry {
+				observers := make([]*stateObserverEntry, 0, len(h.stateObservers)-1)
+				observers = append(observers, h.stateObservers[:i]...)
+				h.stateObservers = append(observers, h.stateObservers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// lockedAddStateObserver registers an observer and returns its registration.
+// The lock must be held when this method is called.
+func (h *Helper) lockedAddStateObserver(observer StateObserver) *stateObserverEntry {
+	entry := &stateObserverEntry{observer: observer}
+	observers := make([]*stateObserverEntry, len(h.stateObservers), len(h.stateObservers)+1)
+	copy(observers, h.stateObservers)
+	h.stateObservers = append(observers, entry)
+	return entry
+}
+
+// lockedSetState changes the state of the helper and queues the transition for delivery to
+// observers. The lock must be held when this method is called, and dispatchStateTransitions must
+// be called after the lock is released.
+func (h *Helper) lockedSetState(newState State, err error) {
+	oldState := h.state
+	h.state = newState
+	if h.leakTracker != nil {
+		h.leakTracker.setState(newState)
+	}
+	if len(h.stateObservers) > 0 {
+		h.pendingTransitions = append(h.pendingTransitions, stateTransition{
+			oldState: oldState,
+			newState: newState,
+			info:     TransitionInfo{Time: time.Now(), Err: err},
+		})
+	}
+}
+
+// dispatchStateTransitions delivers queued state transitions to observers. If another goroutine
+// is already delivering transitions, it returns immediately and that goroutine delivers the queued
+// transitions in order. The lock must not be held when this method is called.
+func (h *Helper) dispatchStateTransitions() {
+	h.Lock.Lock()
+	if h.dispatchingTransitions || len(h.pendingTransitions) == 0 {
+		h.Lock.Unlock()
+		return
+	}
+	h.dispatchingTransitions = true
+	finished := false
+	defer func() {
+		if !finished {
+			// An observer panicked; don't prevent later transitions from being delivered
+			h.Lock.Lock()
+			h.dispatchingTransitions = false
+			h.Lock.Unlock()
+		}
+	}()
+	for len(h.pendingTransitions) > 0 {
+		t := h.pendingTransitions[0]
+		h.pendingTransitions = h.pendingTransitions[1:]
+		observers := h.stateObservers
+		h.Lock.Unlock()
+		for _, entry := range observers {
+			observer := entry.observer
+			h.callRecovering("state observer", func() error {
+				observer(t.oldState, t.newState, t.info)
+				return nil
+			})
+		}
+		h.Lock.Lock()
+	}
+	h.pendingTransitions = nil
+	h.dispatchingTransitions = false
+	finished = true
+	h.Lock.Unlock()
+}
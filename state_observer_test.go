@@ -0,0 +1,118 @@
+package asyncobj
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transitionLog records the state transitions delivered to one or more observers
+type transitionLog struct {
+	lock     sync.Mutex
+	entries  []string
+	shutDown chan struct{}
+}
+
+func newTransitionLog() *transitionLog {
+	return &transitionLog{shutDown: make(chan struct{})}
+}
+
+// observer returns a StateObserver that records each transition it receives, prefixed with name. The
+// last observer to be registered should close the log's shutDown chan on StateShutDown.
+func (l *transitionLog) observer(name string, last bool) StateObserver {
+	return func(oldState State, newState State, info TransitionInfo) {
+		l.lock.Lock()
+		entry := fmt.Sprintf("%s %s->%s", name, oldState, newState)
+		if info.Err != nil {
+			entry += " " + info.Err.Error()
+		}
+		l.entries = append(l.entries, entry)
+		l.lock.Unlock()
+		if last && newState == StateShutDown {
+			close(l.shutDown)
+		}
+	}
+}
+
+// await waits until StateShutDown has been delivered, then checks that exactly want was recorded
+func (l *transitionLog) await(t *testing.T, want ...string) {
+	t.Helper()
+	select {
+	case <-l.shutDown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StateShutDown was not delivered to observers")
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if strings.Join(l.entries, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Observed transitions:\n%s\nexpected:\n%s", strings.Join(l.entries, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStateObserverActivationFailure(t *testing.T) {
+	h := newTestHelper()
+	l := newTransitionLog()
+	h.AddStateObserver(l.observer("first", false))
+	h.AddStateObserver(l.observer("second", true))
+	activateErr := errors.New("activation failed")
+	if err := h.DoOnceActivate(func() error { return activateErr }, true); err != activateErr {
+		t.Fatalf("DoOnceActivate returned %v; expected %v", err, activateErr)
+	}
+	l.await(t,
+		"first StateUnactivated->StateActivating",
+		"second StateUnactivated->StateActivating",
+		"first StateActivating->StateShuttingDown activation failed",
+		"second StateActivating->StateShuttingDown activation failed",
+		"first StateShuttingDown->StateLocalShutdown activation failed",
+		"second StateShuttingDown->StateLocalShutdown activation failed",
+		"first StateLocalShutdown->StateShutDown activation failed",
+		"second StateLocalShutdown->StateShutDown activation failed",
+	)
+}
+
+func TestStateObserverPanicRecovered(t *testing.T) {
+	h := newTestHelper()
+	h.SetRecoverPanics(true)
+	l := newTransitionLog()
+	h.AddStateObserver(func(oldState State, newState State, info TransitionInfo) {
+		panic("observer panic")
+	})
+	h.AddStateObserver(l.observer("observer", true))
+	h.SetIsActivated()
+	h.Close()
+	l.await(t,
+		"observer StateUnactivated->StateActivated",
+		"observer StateActivated->StateShuttingDown",
+		"observer StateShuttingDown->StateLocalShutdown",
+		"observer StateLocalShutdown->StateShutDown",
+	)
+}
+
+func TestStateObserverPanicNotRecovered(t *testing.T) {
+	h := newTestHelper()
+	l := newTransitionLog()
+	h.AddStateObserver(func(oldState State, newState State, info TransitionInfo) {
+		if newState == StateActivated {
+			panic("observer panic")
+		}
+	})
+	h.AddStateObserver(l.observer("observer", true))
+	func() {
+		defer func() {
+			if r := recover(); r != "observer panic" {
+				t.Fatalf("Recovered %v; expected the observer's panic", r)
+			}
+		}()
+		h.SetIsActivated()
+	}()
+	// The panic must not prevent later transitions from being delivered
+	h.Close()
+	l.await(t,
+		"observer StateActivated->StateShuttingDown",
+		"observer StateShuttingDown->StateLocalShutdown",
+		"observer StateLocalShutdown->StateShutDown",
+	)
+}
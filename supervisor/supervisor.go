@@ -0,0 +1,361 @@
+// Package supervisor provides an Erlang-style Supervisor that owns a set of child objects implementing
+// asyncobj.AsyncShutdowner, and restarts them according to a restart strategy when they shut down.
+// A Supervisor embeds an *asyncobj.Helper, so it is itself an asyncobj.AsyncHelper and supervisors can be
+// nested to build supervision trees.
+package supervisor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sammck-go/asyncobj"
+	"github.com/sammck-go/logger"
+)
+
+// Strategy determines which children are restarted when a supervised child shuts down.
+type Strategy int
+
+const (
+	// OneForOne restarts only the child that shut down.
+	OneForOne Strategy = iota
+
+	// OneForAll shuts down all remaining children (in reverse start order) and then restarts
+	// all children (in start order).
+	OneForAll
+
+	// RestForOne shuts down all children that were started after the child that shut down (in
+	// reverse start order), and then restarts the child that shut down along with those children
+	// (in start order).
+	RestForOne
+)
+
+// String returns a human-readable name for a Strategy
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one_for_one"
+	case OneForAll:
+		return "one_for_all"
+	case RestForOne:
+		return "rest_for_one"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// ChildFactory creates a new instance of a supervised child. The returned child should already be
+// activated (e.g., the factory should call DoOnceActivate before returning it). Once the child
+// shuts down for any reason other than shutdown of the supervisor, the supervisor will call the
+// factory again to replace it.
+type ChildFactory func() (asyncobj.AsyncShutdowner, error)
+
+// ChildExitError describes the unplanned shutdown of a supervised child.
+type ChildExitError struct {
+	// Name is the name the child was registered with
+	Name string
+
+	// Err is the final completion status of the child, which may be nil
+	Err error
+}
+
+// Error returns a description of the child exit
+func (e *ChildExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("Supervised child \"%s\" exited", e.Name)
+	}
+	return fmt.Sprintf("Supervised child \"%s\" exited: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the final completion status of the child
+func (e *ChildExitError) Unwrap() error {
+	return e.Err
+}
+
+// RestartIntensityError is the completion status of a Supervisor that shut itself down because its
+// children exited more than MaxRestarts times within Window.
+type RestartIntensityError struct {
+	// MaxRestarts is the maximum number of restarts that were permitted within Window
+	MaxRestarts int
+
+	// Window is the sliding time window in which restarts are counted
+	Window time.Duration
+
+	// MultiError contains a *ChildExitError for each child exit within the window, and the error returned by
+	// the child's factory for each failed restart, oldest first. errors.Is and errors.As succeed if they
+	// succeed for any of them.
+	asyncobj.MultiError
+}
+
+// Error returns a description of the restart intensity failure, including each child exit
+func (e *RestartIntensityError) Error() string {
+	return fmt.Sprintf("Supervisor restart intensity exceeded (%d child exits within %s; at most %d restarts permitted): %s",
+		len(e.Errors), e.Window, e.MaxRestarts, e.MultiError.Error())
+}
+
+// child is the bookkeeping for a single supervised child slot
+type child struct {
+	// name is the name the child was registered with
+	name string
+
+	// index is the position of the child in start order
+	index int
+
+	// factory creates new instances of the child
+	factory ChildFactory
+
+	// obj is the currently running instance of the child, or nil if it is not running
+	obj asyncobj.AsyncShutdowner
+
+	// generation is incremented each time the child is deliberately stopped or restarted, so
+	// that exits of stale instances can be ignored
+	generation int
+}
+
+// childExit is sent from a child watcher goroutine to the monitor goroutine when a child shuts down
+type childExit struct {
+	c          *child
+	generation int
+	err        error
+}
+
+// Supervisor is an *asyncobj.Helper that owns a set of children and restarts them according to
+// a Strategy when they shut down. If children exit more than maxRestarts times within a sliding window,
+// the supervisor gives up and shuts itself down (and all of its children) with a *RestartIntensityError.
+// A child whose factory fails while it is being restarted counts as another exit of that child.
+//
+// Children are started in registration order when the supervisor is activated, and are shut down in
+// reverse registration order when the supervisor shuts down.
+type Supervisor struct {
+	*asyncobj.Helper
+
+	// strategy determines which children are restarted when a child exits
+	strategy Strategy
+
+	// maxRestarts is the maximum number of restarts permitted within window
+	maxRestarts int
+
+	// window is the sliding time window in which restarts are counted
+	window time.Duration
+
+	// lock protects children and activationStarted while children are being registered
+	lock sync.Mutex
+
+	// activationStarted is set when HandleOnceActivate is called; no children may be added after that
+	activationStarted bool
+
+	// children is the list of children in start order. The list may only be modified before activation.
+	// After activation, child state is owned by the monitor goroutine until it exits, then by the shutdown handler.
+	children []*child
+
+	// exitChan receives notifications of child exits from watcher goroutines
+	exitChan chan childExit
+
+	// monitorDone is closed when the monitor goroutine exits
+	monitorDone chan struct{}
+
+	// monitorStarted is true if the monitor goroutine was started during activation
+	monitorStarted bool
+
+	// restartTimes and restartErrs record each child exit within the current window, oldest first.
+	restartTimes []time.Time
+	restartErrs  []error
+}
+
+// NewSupervisor creates a new Supervisor with the given restart strategy and intensity. If children exit
+// more than maxRestarts times within window, the supervisor shuts itself down. If maxRestarts is 0, any
+// child exit shuts down the supervisor.
+// if logger is nil, a NilLogger is attached.
+func NewSupervisor(
+	logger logger.Logger,
+	strategy Strategy,
+	maxRestarts int,
+	window time.Duration,
+) *Supervisor {
+	s := &Supervisor{
+		strategy:    strategy,
+		maxRestarts: maxRestarts,
+		window:      window,
+		exitChan:    make(chan childExit),
+		monitorDone: make(chan struct{}),
+	}
+	s.Helper = asyncobj.NewHelper(logger, s).(*asyncobj.Helper)
+	return s
+}
+
+// AddChild registers a child to be started when the supervisor is activated and restarted according
+// to the supervisor's strategy. Children are started in the order they are added.
+// Cannot be called after activation has started.
+func (s *Supervisor) AddChild(name string, factory ChildFactory) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.activationStarted {
+		return fmt.Errorf("Cannot add supervised child \"%s\" after activation has started", name)
+	}
+	s.children = append(s.children, &child{
+		name:    name,
+		index:   len(s.children),
+		factory: factory,
+	})
+	return nil
+}
+
+// HandleOnceActivate starts all children in registration order, then begins monitoring them.
+// If any child fails to start, the already-started children are shut down in reverse order and
+// activation fails.
+func (s *Supervisor) HandleOnceActivate() error {
+	s.lock.Lock()
+	s.activationStarted = true
+	s.lock.Unlock()
+	for i, c := range s.children {
+		err := s.startChild(c)
+		if err != nil {
+			s.stopChildren(s.children[:i], err)
+			// Release the watchers of the children we just stopped
+			close(s.monitorDone)
+			return err
+		}
+	}
+	s.monitorStarted = true
+	go s.monitor()
+	return nil
+}
+
+// HandleOnceShutdown stops monitoring children, then shuts them down in reverse registration order,
+// waiting for each to complete before shutting down the next.
+func (s *Supervisor) HandleOnceShutdown(completionErr error) error {
+	if s.monitorStarted {
+		<-s.monitorDone
+	}
+	s.stopChildren(s.children, completionErr)
+	return completionErr
+}
+
+// startChild creates a new instance of a child and begins watching it for exit.
+func (s *Supervisor) startChild(c *child) error {
+	obj, err := c.factory()
+	if err != nil {
+		return fmt.Errorf("Supervisor failed to start child \"%s\": %w", c.name, err)
+	}
+	c.generation++
+	c.obj = obj
+	s.Lg().DLogf("Supervisor started child \"%s\"", c.name)
+	generation := c.generation
+	go func() {
+		select {
+		case <-obj.ShutdownDoneChan():
+			select {
+			case s.exitChan <- childExit{c: c, generation: generation, err: obj.WaitShutdown()}:
+			case <-s.monitorDone:
+			}
+		case <-s.monitorDone:
+		}
+	}()
+	return nil
+}
+
+// stopChildren shuts down each running child in children, in reverse order, waiting for each
+// to complete before shutting down the next.
+func (s *Supervisor) stopChildren(children []*child, completionErr error) {
+	for i := len(children) - 1; i >= 0; i-- {
+		c := children[i]
+		if c.obj != nil {
+			// Bump the generation so the resulting exit is not mistaken for a failure
+			c.generation++
+			obj := c.obj
+			c.obj = nil
+			obj.StartShutdown(completionErr)
+			err := obj.WaitShutdown()
+			if err != nil {
+				s.Lg().DLogf("Supervisor stopped child \"%s\" with error: %s", c.name, err)
+			} else {
+				s.Lg().DLogf("Supervisor stopped child \"%s\"", c.name)
+			}
+		}
+	}
+}
+
+// monitor is the goroutine that handles child exits until shutdown starts.
+func (s *Supervisor) monitor() {
+	defer close(s.monitorDone)
+	for {
+		select {
+		case <-s.ShutdownStartedChan():
+			return
+		case exit := <-s.exitChan:
+			if exit.generation != exit.c.generation {
+				// A stale instance that we stopped deliberately
+				continue
+			}
+			exit.c.obj = nil
+			err := s.handleChildExit(exit)
+			if err != nil {
+				s.StartShutdown(err)
+				return
+			}
+		}
+	}
+}
+
+// handleChildExit applies the restart intensity limit and the restart strategy to an unplanned child exit.
+// If a child's factory fails while it is being restarted, that counts as another exit of that child, and the
+// strategy is applied again; children restarted before it are stopped again as the strategy requires.
+// Returns a non-nil error if the supervisor should give up and shut down.
+func (s *Supervisor) handleChildExit(exit childExit) error {
+	c := exit.c
+	var exitErr error = &ChildExitError{Name: c.name, Err: exit.err}
+	for {
+		s.Lg().DLogf("%s; applying %s restart strategy", exitErr, s.strategy)
+		err := s.countRestart(exitErr)
+		if err != nil {
+			return err
+		}
+
+		var restart []*child
+		switch s.strategy {
+		case OneForAll:
+			restart = s.children
+		case RestForOne:
+			restart = s.children[c.index:]
+		default:
+			restart = []*child{c}
+		}
+
+		s.stopChildren(restart, nil)
+		c, exitErr = s.startChildren(restart)
+		if exitErr == nil {
+			return nil
+		}
+	}
+}
+
+// countRestart records a child exit, or a failure to restart a child, in the restart window. Returns a
+// *RestartIntensityError if the restart intensity limit has been exceeded.
+func (s *Supervisor) countRestart(exitErr error) error {
+	now := time.Now()
+	firstInWindow := 0
+	for firstInWindow < len(s.restartTimes) && now.Sub(s.restartTimes[firstInWindow]) >= s.window {
+		firstInWindow++
+	}
+	s.restartTimes = append(s.restartTimes[firstInWindow:], now)
+	s.restartErrs = append(s.restartErrs[firstInWindow:], exitErr)
+	if len(s.restartTimes) > s.maxRestarts {
+		return &RestartIntensityError{
+			MaxRestarts: s.maxRestarts,
+			Window:      s.window,
+			MultiError:  asyncobj.MultiError{Errors: append([]error(nil), s.restartErrs...)},
+		}
+	}
+	return nil
+}
+
+// startChildren starts each child in children, in order. If a child fails to start, the remaining children
+// are not started, and that child and the error are returned.
+func (s *Supervisor) startChildren(children []*child) (*child, error) {
+	for _, c := range children {
+		err := s.startChild(c)
+		if err != nil {
+			return c, err
+		}
+	}
+	return nil, nil
+}
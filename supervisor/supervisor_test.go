@@ -0,0 +1,260 @@
+package supervisor
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sammck-go/asyncobj"
+)
+
+// testTimeout bounds every wait in these tests
+const testTimeout = 5 * time.Second
+
+// eventLog records the starts and stops of supervised children, and the latest instance of each
+type eventLog struct {
+	lock      sync.Mutex
+	events    []string
+	instances map[string]asyncobj.AsyncHelper
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{instances: make(map[string]asyncobj.AsyncHelper)}
+}
+
+func (l *eventLog) add(event string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.events = append(l.events, event)
+}
+
+// snapshot returns the events recorded so far
+func (l *eventLog) snapshot() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// instance returns the latest instance of the named child
+func (l *eventLog) instance(name string) asyncobj.AsyncHelper {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.instances[name]
+}
+
+// factory returns a ChildFactory that creates activated children that log their starts and stops
+func (l *eventLog) factory(name string) ChildFactory {
+	return func() (asyncobj.AsyncShutdowner, error) {
+		h := asyncobj.NewHelperWithShutdownHandler(nil, nil, func(completionErr error) error {
+			l.add("stop " + name)
+			return completionErr
+		})
+		err := h.DoOnceActivate(func() error {
+			l.add("start " + name)
+			return nil
+		}, true)
+		if err != nil {
+			return nil, err
+		}
+		l.lock.Lock()
+		l.instances[name] = h
+		l.lock.Unlock()
+		return h, nil
+	}
+}
+
+// await waits until the log contains exactly want, failing the test if it does not within testTimeout
+func (l *eventLog) await(t *testing.T, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		got := l.snapshot()
+		if len(got) >= len(want) {
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("Events %v; expected %v", got, want)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Events %v; still waiting for %v", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestSupervisor creates and activates a supervisor with children a, b and c
+func newTestSupervisor(t *testing.T, l *eventLog, strategy Strategy, maxRestarts int) *Supervisor {
+	t.Helper()
+	s := NewSupervisor(nil, strategy, maxRestarts, time.Minute)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := s.AddChild(name, l.factory(name)); err != nil {
+			t.Fatalf("AddChild failed: %s", err)
+		}
+	}
+	if err := s.DoOnceActivate(nil, true); err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+	l.await(t, "start a", "start b", "start c")
+	return s
+}
+
+func TestRestartStrategies(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		restart  []string
+	}{
+		{OneForOne, []string{"start b"}},
+		{OneForAll, []string{"stop c", "stop a", "start a", "start b", "start c"}},
+		{RestForOne, []string{"stop c", "start b", "start c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.strategy.String(), func(t *testing.T) {
+			l := newEventLog()
+			s := newTestSupervisor(t, l, test.strategy, 10)
+			l.instance("b").StartShutdown(errors.New("child failed"))
+			want := append([]string{"start a", "start b", "start c", "stop b"}, test.restart...)
+			l.await(t, want...)
+
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close returned %s", err)
+			}
+			l.await(t, append(want, "stop c", "stop b", "stop a")...)
+		})
+	}
+}
+
+func TestRestartIntensity(t *testing.T) {
+	l := newEventLog()
+	s := newTestSupervisor(t, l, OneForOne, 1)
+	childErr := errors.New("child failed")
+	l.instance("b").StartShutdown(childErr)
+	l.await(t, "start a", "start b", "start c", "stop b", "start b")
+	l.instance("b").StartShutdown(childErr)
+
+	var err error
+	select {
+	case <-s.ShutdownDoneChan():
+		err = s.WaitShutdown()
+	case <-time.After(testTimeout):
+		t.Fatal("Supervisor did not give up after exceeding its restart intensity")
+	}
+	var intensityErr *RestartIntensityError
+	if !errors.As(err, &intensityErr) {
+		t.Fatalf("Supervisor shut down with %v; expected a *RestartIntensityError", err)
+	}
+	if len(intensityErr.Errors) != 2 || intensityErr.MaxRestarts != 1 {
+		t.Fatalf("Unexpected RestartIntensityError %+v", intensityErr)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "2 child exits") || !strings.Contains(msg, "at most 1 restarts") {
+		t.Fatalf("Unexpected error message %q", msg)
+	}
+	if !errors.Is(err, childErr) {
+		t.Fatal("RestartIntensityError does not match the child's error")
+	}
+	var exitErr *ChildExitError
+	if !errors.As(err, &exitErr) || exitErr.Name != "b" {
+		t.Fatalf("RestartIntensityError does not contain the exit of child b: %v", err)
+	}
+	// All remaining children are stopped in reverse order
+	l.await(t, "start a", "start b", "start c", "stop b", "start b", "stop b", "stop c", "stop a")
+}
+
+func TestNestedSupervisorShutdown(t *testing.T) {
+	l := newEventLog()
+	var inner *Supervisor
+	outer := NewSupervisor(nil, OneForOne, 1, time.Minute)
+	outer.AddChild("inner", func() (asyncobj.AsyncShutdowner, error) {
+		inner = NewSupervisor(nil, OneForOne, 1, time.Minute)
+		inner.AddChild("x", l.factory("x"))
+		inner.AddChild("y", l.factory("y"))
+		if err := inner.DoOnceActivate(nil, true); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	})
+	outer.AddChild("z", l.factory("z"))
+	if err := outer.DoOnceActivate(nil, true); err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+	l.await(t, "start x", "start y", "start z")
+
+	if err := outer.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+	if !inner.IsDoneShutdown() {
+		t.Fatal("Nested supervisor was not shut down before its parent finished")
+	}
+	l.await(t, "start x", "start y", "start z", "stop z", "stop y", "stop x")
+}
+
+func TestAddChildAfterActivation(t *testing.T) {
+	l := newEventLog()
+	s := newTestSupervisor(t, l, OneForOne, 1)
+	if err := s.AddChild("d", l.factory("d")); err == nil {
+		t.Fatal("AddChild succeeded after activation")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close returned %s", err)
+	}
+}
+
+// failOnCall wraps factory so that its nth call (counting from 1) fails with err
+func failOnCall(factory ChildFactory, n int, err error) ChildFactory {
+	var lock sync.Mutex
+	calls := 0
+	return func() (asyncobj.AsyncShutdowner, error) {
+		lock.Lock()
+		calls++
+		call := calls
+		lock.Unlock()
+		if call == n {
+			return nil, err
+		}
+		return factory()
+	}
+}
+
+func TestRestartFactoryFailure(t *testing.T) {
+	factoryErr := errors.New("factory failed")
+	start := func(maxRestarts int) (*Supervisor, *eventLog) {
+		l := newEventLog()
+		s := NewSupervisor(nil, RestForOne, maxRestarts, time.Minute)
+		s.AddChild("a", l.factory("a"))
+		s.AddChild("b", l.factory("b"))
+		// c cannot be restarted the first time
+		s.AddChild("c", failOnCall(l.factory("c"), 2, factoryErr))
+		if err := s.DoOnceActivate(nil, true); err != nil {
+			t.Fatalf("DoOnceActivate failed: %s", err)
+		}
+		l.await(t, "start a", "start b", "start c")
+		l.instance("b").StartShutdown(errors.New("child failed"))
+		return s, l
+	}
+
+	// The failed restart of c counts as an exit of c, so RestForOne restarts c again
+	s, l := start(10)
+	l.await(t, "start a", "start b", "start c", "stop b", "stop c", "start b", "start c")
+	if s.IsScheduledShutdown() {
+		t.Fatal("Supervisor shut down after a failed restart within its restart intensity")
+	}
+	s.Close()
+
+	// With the failed restart, the restart intensity is exceeded
+	s, l = start(1)
+	select {
+	case <-s.ShutdownDoneChan():
+	case <-time.After(testTimeout):
+		t.Fatal("Supervisor did not give up after exceeding its restart intensity")
+	}
+	var intensityErr *RestartIntensityError
+	if err := s.WaitShutdown(); !errors.As(err, &intensityErr) {
+		t.Fatalf("Supervisor shut down with %v; expected a *RestartIntensityError", err)
+	}
+	if len(intensityErr.Errors) != 2 || !errors.Is(intensityErr.Errors[1], factoryErr) {
+		t.Fatalf("Unexpected RestartIntensityError %v", intensityErr)
+	}
+	// The children that were restarted are stopped along with the supervisor
+	l.await(t, "start a", "start b", "start c", "stop b", "stop c", "start b", "stop b", "stop a")
+}
@@ -0,0 +1,210 @@
+package asyncobj
+
+import (
+	"context"
+	"fmt"
+)
+
+// HandleSuspender may be implemented by the object managed by a Helper if the object needs to take action
+// when it is suspended. Objects that do not implement it can still be suspended; suspension then affects
+// only the object's state and its registered children.
+type HandleSuspender interface {
+	// HandleSuspend is called from Suspend, in StateSuspending, with shutdown deferred, to pause the
+	// object without tearing it down. ctx is cancelled if shutdown is scheduled while suspension is in
+	// progress. If it returns an error, the object returns to StateActivated.
+	HandleSuspend(ctx context.Context) error
+}
+
+// HandleResumer may be implemented by the object managed by a Helper if the object needs to take action
+// when it is resumed after being suspended.
+type HandleResumer interface {
+	// HandleResume is called from Resume, in StateSuspended, with shutdown deferred, after the object's
+	// registered children have been resumed. ctx is cancelled if shutdown is scheduled while resumption is
+	// in progress. If it returns an error, the object remains in StateSuspended.
+	HandleResume(ctx context.Context) error
+}
+
+// suspendableChild is implemented by registered children that can be suspended along with their parent,
+// including *Helper and all objects that embed one.
+type suspendableChild interface {
+	GetAsyncObjState() State
+	Suspend(ctx context.Context) error
+	Resume(ctx context.Context) error
+}
+
+// Suspend pauses an activated object without shutting it down. The object enters StateSuspending, its
+// HandleSuspend method is called (if it implements HandleSuspender), and then each registered child that is
+// in StateActivated and can be suspended is suspended in turn, after which the object enters StateSuspended.
+// The children suspended are recorded so that Resume can resume exactly those children in reverse order.
+// Shutdown is deferred while Suspend is in progress; shutdown of a suspended object proceeds normally,
+// including the call to HandleOnceShutdown.
+//
+// If HandleSuspend or the suspension of a child fails, the children already suspended are resumed in reverse
+// order, the object's HandleResume method is called if HandleSuspend succeeded, the object returns to
+// StateActivated, and the error is returned. The undo is done with a context that is never cancelled, since
+// ctx may already be done. Suspend and Resume are serialized with each other.
+// Does nothing if the object is already suspended. Fails if the object is not activated, or if shutdown
+// has been scheduled.
+func (h *Helper) Suspend(ctx context.Context) error {
+	h.suspendLock.Lock()
+	defer h.suspendLock.Unlock()
+
+	h.Lock.Lock()
+	if h.state == StateSuspended {
+		h.Lock.Unlock()
+		return nil
+	}
+	if h.state != StateActivated || h.isScheduledShutdown {
+		state := h.state
+		h.Lock.Unlock()
+		return fmt.Errorf("Cannot suspend in %s; object must be activated and not shutting down", state)
+	}
+	h.shutdownDeferCount++
+	h.lockedSetState(StateSuspending, nil)
+	suspendCtx, cancel := context.WithCancel(ctx)
+	h.suspendCancel = cancel
+	children := h.lockedSuspendableChildren()
+	h.Lock.Unlock()
+	h.dispatchStateTransitions()
+	defer h.UndeferShutdown()
+
+	err := h.callRecovering("suspend handler", func() error {
+		if suspender, ok := h.obj.(HandleSuspender); ok {
+			return suspender.HandleSuspend(suspendCtx)
+		}
+		return nil
+	})
+	if err == nil {
+		var suspended []suspendableChild
+		for _, child := range children {
+			if child.GetAsyncObjState() != StateActivated {
+				// Children that are not yet activated, already suspended, or shutting down are left alone
+				continue
+			}
+			err = child.Suspend(suspendCtx)
+			if err != nil {
+				h.lg.DLogf("Suspend of child \"%s\" failed: %s", describeObject(child), err)
+				break
+			}
+			suspended = append(suspended, child)
+		}
+		if err == nil {
+			h.suspendedChildren = suspended
+		} else {
+			// Undo the partial suspension. suspendCtx may already be cancelled, which is often why suspension
+			// failed, so the undo must not depend on it.
+			undoCtx := context.Background()
+			for i := len(suspended) - 1; i >= 0; i-- {
+				child := suspended[i]
+				if resumeErr := child.Resume(undoCtx); resumeErr != nil {
+					h.lg.DLogf("Resume of child \"%s\" after failed suspend failed: %s", describeObject(child), resumeErr)
+				}
+			}
+			h.callResumeHandler(undoCtx)
+		}
+	}
+
+	h.Lock.Lock()
+	h.suspendCancel = nil
+	if err == nil {
+		h.lockedSetState(StateSuspended, nil)
+	} else {
+		h.lockedSetState(StateActivated, nil)
+	}
+	h.Lock.Unlock()
+	cancel()
+	h.dispatchStateTransitions()
+	return err
+}
+
+// Resume returns a suspended object to StateActivated. The children suspended by Suspend are resumed first,
+// in exactly the reverse of the order in which they were suspended, skipping any that are no longer in
+// StateSuspended, and then the object's HandleResume method is called (if it implements HandleResumer).
+// Shutdown is deferred while Resume is in progress. If resumption of a child or HandleResume fails, the
+// children already resumed are suspended again in their original order, with a context that is never
+// cancelled, the object remains in StateSuspended, and the error is returned. Suspend and Resume are serialized with each other.
+// Does nothing if the object is activated and not suspended. Fails if the object is not suspended, or if
+// shutdown has been scheduled.
+func (h *Helper) Resume(ctx context.Context) error {
+	h.suspendLock.Lock()
+	defer h.suspendLock.Unlock()
+
+	h.Lock.Lock()
+	if h.state == StateActivated {
+		h.Lock.Unlock()
+		return nil
+	}
+	if h.state != StateSuspended || h.isScheduledShutdown {
+		state := h.state
+		h.Lock.Unlock()
+		return fmt.Errorf("Cannot resume in %s; object must be suspended and not shutting down", state)
+	}
+	h.shutdownDeferCount++
+	resumeCtx, cancel := context.WithCancel(ctx)
+	h.suspendCancel = cancel
+	h.Lock.Unlock()
+	defer h.UndeferShutdown()
+
+	var err error
+	var resumed []suspendableChild
+	for i := len(h.suspendedChildren) - 1; i >= 0; i-- {
+		child := h.suspendedChildren[i]
+		if child.GetAsyncObjState() != StateSuspended {
+			// Children that have been resumed independently or are shutting down are left alone
+			continue
+		}
+		err = child.Resume(resumeCtx)
+		if err != nil {
+			h.lg.DLogf("Resume of child \"%s\" failed: %s", describeObject(child), err)
+			break
+		}
+		resumed = append(resumed, child)
+	}
+	if err == nil {
+		err = h.callResumeHandler(resumeCtx)
+	}
+	if err == nil {
+		h.suspendedChildren = nil
+	} else {
+		// Undo the partial resumption. resumeCtx may already be cancelled, which is often why resumption
+		// failed, so the undo must not depend on it.
+		undoCtx := context.Background()
+		for i := len(resumed) - 1; i >= 0; i-- {
+			child := resumed[i]
+			if suspendErr := child.Suspend(undoCtx); suspendErr != nil {
+				h.lg.DLogf("Suspend of child \"%s\" after failed resume failed: %s", describeObject(child), suspendErr)
+			}
+		}
+	}
+
+	h.Lock.Lock()
+	h.suspendCancel = nil
+	if err == nil {
+		h.lockedSetState(StateActivated, nil)
+	}
+	h.Lock.Unlock()
+	cancel()
+	h.dispatchStateTransitions()
+	return err
+}
+
+// callResumeHandler calls the object's HandleResume method, if it implements HandleResumer.
+func (h *Helper) callResumeHandler(ctx context.Context) error {
+	return h.callRecovering("resume handler", func() error {
+		if resumer, ok := h.obj.(HandleResumer); ok {
+			return resumer.HandleResume(ctx)
+		}
+		return nil
+	})
+}
+
+// lockedSuspendableChildren returns the registered children that can be suspended. The lock must be held when this method is called.
+func (h *Helper) lockedSuspendableChildren() []suspendableChild {
+	var children []suspendableChild
+	for _, reg := range h.children {
+		if child, ok := reg.asyncChild.(suspendableChild); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
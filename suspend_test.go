@@ -0,0 +1,207 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// suspendLog records suspend and resume calls in order
+type suspendLog struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (l *suspendLog) add(event string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *suspendLog) take() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	events := l.events
+	l.events = nil
+	return events
+}
+
+// suspendObject is a managed object that logs its suspend and resume handlers. Like a well-behaved
+// object, its handlers fail if ctx is already done.
+type suspendObject struct {
+	name      string
+	log       *suspendLog
+	resumeErr error
+
+	// suspendHook, if not nil, is called by HandleSuspend before it checks ctx
+	suspendHook func()
+
+	// resumeHook, if not nil, is called by HandleResume before it checks ctx
+	resumeHook func()
+}
+
+func (o *suspendObject) HandleOnceShutdown(completionErr error) error {
+	return completionErr
+}
+
+func (o *suspendObject) HandleSuspend(ctx context.Context) error {
+	o.log.add("suspend " + o.name)
+	if o.suspendHook != nil {
+		o.suspendHook()
+	}
+	return ctx.Err()
+}
+
+func (o *suspendObject) HandleResume(ctx context.Context) error {
+	o.log.add("resume " + o.name)
+	if o.resumeHook != nil {
+		o.resumeHook()
+	}
+	if o.resumeErr != nil {
+		return o.resumeErr
+	}
+	return ctx.Err()
+}
+
+// newSuspendHelper creates an activated helper for a suspendObject
+func newSuspendHelper(t *testing.T, obj *suspendObject) *Helper {
+	h := NewHelper(nil, obj).(*Helper)
+	if err := h.DoOnceActivate(func() error { return nil }, true); err != nil {
+		t.Fatalf("DoOnceActivate failed: %s", err)
+	}
+	return h
+}
+
+func checkEvents(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("Got events %v; expected %v", got, expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("Got events %v; expected %v", got, expected)
+		}
+	}
+}
+
+func TestResumeOrder(t *testing.T) {
+	log := &suspendLog{}
+	parentObj := &suspendObject{name: "parent", log: log}
+	parent := newSuspendHelper(t, parentObj)
+	var handles []ChildHandle
+	for _, name := range []string{"a", "b", "c", "d"} {
+		handle, err := parent.AddAsyncShutdownChild(newSuspendHelper(t, &suspendObject{name: name, log: log}))
+		if err != nil {
+			t.Fatalf("AddAsyncShutdownChild failed: %s", err)
+		}
+		handles = append(handles, handle)
+	}
+	ctx := context.Background()
+	if err := parent.Suspend(ctx); err != nil {
+		t.Fatalf("Suspend failed: %s", err)
+	}
+	suspendOrder := log.take()
+
+	// Swap-remove reorders the registered children, but must not change the resume order
+	handles[0].Detach()
+	if err := parent.Resume(ctx); err != nil {
+		t.Fatalf("Resume failed: %s", err)
+	}
+	resumeOrder := log.take()
+	if len(resumeOrder) != len(suspendOrder) {
+		t.Fatalf("Resumed %v after suspending %v", resumeOrder, suspendOrder)
+	}
+	for i, event := range suspendOrder[1:] {
+		if expected := "resume" + event[len("suspend"):]; resumeOrder[len(resumeOrder)-2-i] != expected {
+			t.Fatalf("Resumed %v after suspending %v", resumeOrder, suspendOrder)
+		}
+	}
+	if resumeOrder[len(resumeOrder)-1] != "resume parent" {
+		t.Fatalf("Parent resumed before its children: %v", resumeOrder)
+	}
+	parent.Shutdown(nil)
+}
+
+func TestResumeFailure(t *testing.T) {
+	log := &suspendLog{}
+	resumeErr := errors.New("resume error")
+	parentObj := &suspendObject{name: "parent", log: log}
+	parent := newSuspendHelper(t, parentObj)
+	child := newSuspendHelper(t, &suspendObject{name: "child", log: log})
+	parent.AddAsyncShutdownChild(child)
+	ctx := context.Background()
+	if err := parent.Suspend(ctx); err != nil {
+		t.Fatalf("Suspend failed: %s", err)
+	}
+	log.take()
+
+	parentObj.resumeErr = resumeErr
+	if err := parent.Resume(ctx); err != resumeErr {
+		t.Fatalf("Resume returned %v; expected %v", err, resumeErr)
+	}
+	checkEvents(t, log.take(), "resume child", "resume parent", "suspend child")
+	if state := parent.GetAsyncObjState(); state != StateSuspended {
+		t.Fatalf("Parent is in %s after failed Resume", state)
+	}
+	if state := child.GetAsyncObjState(); state != StateSuspended {
+		t.Fatalf("Child is in %s after parent's failed Resume", state)
+	}
+
+	parentObj.resumeErr = nil
+	if err := parent.Resume(ctx); err != nil {
+		t.Fatalf("Resume failed: %s", err)
+	}
+	checkEvents(t, log.take(), "resume child", "resume parent")
+	parent.Shutdown(nil)
+}
+
+func TestSuspendRollbackCancelled(t *testing.T) {
+	log := &suspendLog{}
+	parent := newSuspendHelper(t, &suspendObject{name: "parent", log: log})
+	a := newSuspendHelper(t, &suspendObject{name: "a", log: log})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// b cancels the caller's context while it is being suspended, so its suspension fails
+	b := newSuspendHelper(t, &suspendObject{name: "b", log: log, suspendHook: cancel})
+	parent.AddAsyncShutdownChild(a)
+	parent.AddAsyncShutdownChild(b)
+
+	if err := parent.Suspend(ctx); err != context.Canceled {
+		t.Fatalf("Suspend returned %v; expected context.Canceled", err)
+	}
+	checkEvents(t, log.take(), "suspend parent", "suspend a", "suspend b", "resume a", "resume parent")
+	for _, h := range []*Helper{parent, a, b} {
+		if state := h.GetAsyncObjState(); state != StateActivated {
+			t.Fatalf("%s is in %s after failed Suspend", h.AsyncObjName(), state)
+		}
+	}
+	parent.Shutdown(nil)
+}
+
+func TestResumeRollbackCancelled(t *testing.T) {
+	log := &suspendLog{}
+	parent := newSuspendHelper(t, &suspendObject{name: "parent", log: log})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// a is resumed last, and cancels the caller's context while it is being resumed, so its resumption fails
+	a := newSuspendHelper(t, &suspendObject{name: "a", log: log, resumeHook: cancel})
+	b := newSuspendHelper(t, &suspendObject{name: "b", log: log})
+	parent.AddAsyncShutdownChild(a)
+	parent.AddAsyncShutdownChild(b)
+	if err := parent.Suspend(context.Background()); err != nil {
+		t.Fatalf("Suspend failed: %s", err)
+	}
+	log.take()
+
+	if err := parent.Resume(ctx); err != context.Canceled {
+		t.Fatalf("Resume returned %v; expected context.Canceled", err)
+	}
+	checkEvents(t, log.take(), "resume b", "resume a", "suspend b")
+	for _, h := range []*Helper{parent, a, b} {
+		if state := h.GetAsyncObjState(); state != StateSuspended {
+			t.Fatalf("%s is in %s after failed Resume", h.AsyncObjName(), state)
+		}
+	}
+	parent.Shutdown(nil)
+}
@@ -0,0 +1,209 @@
+package asyncobj
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is a span recorded by a TraceRecorder.
+type RecordedSpan struct {
+	// ID identifies the span within its TraceRecorder. IDs start at 1.
+	ID int
+
+	// ParentID is the ID of the parent span, or 0 for a root span
+	ParentID int
+
+	// Name is the name of the span
+	Name string
+
+	// Start is the time at which the span was opened
+	Start time.Time
+
+	// End is the time at which the span was ended, or the zero Time if it has not ended
+	End time.Time
+
+	// Err is the error the span was ended with
+	Err error
+}
+
+// TraceRecorder is a Tracer that records spans in memory, for inspection in tests or export with
+// WriteChromeTrace. A TraceRecorder is safe for concurrent use.
+type TraceRecorder struct {
+	// lock protects spans
+	lock sync.Mutex
+
+	// spans contains all spans opened so far, in order of ID
+	spans []*RecordedSpan
+}
+
+// recorderSpan is the Span returned by a TraceRecorder
+type recorderSpan struct {
+	r  *TraceRecorder
+	id int
+}
+
+// NewTraceRecorder creates a new, empty TraceRecorder
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+// StartSpan opens a new span. parent must be nil or a span opened by the same TraceRecorder.
+func (r *TraceRecorder) StartSpan(name string, parent Span) Span {
+	parentID := 0
+	if p, ok := parent.(*recorderSpan); ok && p.r == r {
+		parentID = p.id
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	span := &RecordedSpan{
+		ID:       len(r.spans) + 1,
+		ParentID: parentID,
+		Name:     name,
+		Start:    time.Now(),
+	}
+	r.spans = append(r.spans, span)
+	return &recorderSpan{r: r, id: span.ID}
+}
+
+// End records the end of the span. Only the first call has any effect.
+func (s *recorderSpan) End(err error) {
+	s.r.lock.Lock()
+	defer s.r.lock.Unlock()
+	span := s.r.spans[s.id-1]
+	if span.End.IsZero() {
+		span.End = time.Now()
+		span.Err = err
+	}
+}
+
+// Spans returns a copy of all spans recorded so far, in the order they were opened.
+func (r *TraceRecorder) Spans() []RecordedSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]RecordedSpan, len(r.spans))
+	for i, span := range r.spans {
+		result[i] = *span
+	}
+	return result
+}
+
+// chromeTraceEvent is a complete ("X") event in the Chrome trace-event format
+type chromeTraceEvent struct {
+	Name      string                 `json:"name"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Duration  float64                `json:"dur"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// chromeTrace is the top-level object of the Chrome trace-event JSON format
+type chromeTrace struct {
+	TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+// WriteChromeTrace writes the recorded spans to w in the Chrome trace-event JSON format, which can be
+// loaded into chrome://tracing or Perfetto. Spans that have not ended are written as ending now. Each span
+// is drawn nested within its parent where possible; spans that overlap their siblings are placed on
+// separate rows.
+func (r *TraceRecorder) WriteChromeTrace(w io.Writer) error {
+	spans := r.Spans()
+	now := time.Now()
+	for i := range spans {
+		if spans[i].End.IsZero() {
+			spans[i].End = now
+		}
+	}
+	lanes := assignTraceLanes(spans)
+
+	var epoch time.Time
+	for i, span := range spans {
+		if i == 0 || span.Start.Before(epoch) {
+			epoch = span.Start
+		}
+	}
+
+	trace := chromeTrace{
+		TraceEvents:     make([]chromeTraceEvent, len(spans)),
+		DisplayTimeUnit: "ms",
+	}
+	for i, span := range spans {
+		args := map[string]interface{}{"id": span.ID}
+		if span.ParentID != 0 {
+			args["parent"] = span.ParentID
+		}
+		if span.Err != nil {
+			args["error"] = span.Err.Error()
+		}
+		trace.TraceEvents[i] = chromeTraceEvent{
+			Name:      span.Name,
+			Phase:     "X",
+			Timestamp: float64(span.Start.Sub(epoch).Nanoseconds()) / 1000,
+			Duration:  float64(span.End.Sub(span.Start).Nanoseconds()) / 1000,
+			PID:       1,
+			TID:       lanes[i],
+			Args:      args,
+		}
+	}
+	return json.NewEncoder(w).Encode(&trace)
+}
+
+// assignTraceLanes assigns each span (all of which must have ended) to a row of the timeline, such
+// that the spans on a row are properly nested. A span is placed on its parent's row if it fits within
+// the spans open on that row, and otherwise on the first empty row. Returns the row number of each span,
+// starting at 1.
+func assignTraceLanes(spans []RecordedSpan) []int {
+	order := make([]int, len(spans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return spans[order[a]].Start.Before(spans[order[b]].Start)
+	})
+
+	byID := make(map[int]int, len(spans))
+	for i, span := range spans {
+		byID[span.ID] = i
+	}
+
+	lanes := make([]int, len(spans))
+	// open holds, for each row, the stack of spans on that row that may still enclose later spans
+	var open [][]int
+	fits := func(row int, i int) bool {
+		stack := open[row]
+		for len(stack) > 0 && !spans[stack[len(stack)-1]].End.After(spans[i].Start) {
+			stack = stack[:len(stack)-1]
+		}
+		open[row] = stack
+		if len(stack) == 0 {
+			return true
+		}
+		top := spans[stack[len(stack)-1]]
+		return top.ID == spans[i].ParentID && !top.End.Before(spans[i].End)
+	}
+	for _, i := range order {
+		row := -1
+		if parent, ok := byID[spans[i].ParentID]; ok && fits(lanes[parent]-1, i) {
+			row = lanes[parent] - 1
+		} else {
+			for candidate := range open {
+				if fits(candidate, i) && len(open[candidate]) == 0 {
+					row = candidate
+					break
+				}
+			}
+		}
+		if row < 0 {
+			open = append(open, nil)
+			row = len(open) - 1
+		}
+		open[row] = append(open[row], i)
+		lanes[i] = row + 1
+	}
+	return lanes
+}
@@ -0,0 +1,59 @@
+package asyncobj
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestTraceRecorder creates a TraceRecorder containing spans with the given parent IDs and start and end
+// times, in milliseconds after an arbitrary epoch. Span IDs are assigned in order, starting at 1.
+func newTestTraceRecorder(spans ...[3]int) *TraceRecorder {
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewTraceRecorder()
+	for i, s := range spans {
+		r.spans = append(r.spans, &RecordedSpan{
+			ID:       i + 1,
+			ParentID: s[0],
+			Name:     fmt.Sprintf("span%d", i+1),
+			Start:    epoch.Add(time.Duration(s[1]) * time.Millisecond),
+			End:      epoch.Add(time.Duration(s[2]) * time.Millisecond),
+		})
+	}
+	return r
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	r := newTestTraceRecorder([3]int{0, 1, 3}, [3]int{1, 2, 3})
+	r.spans[1].Err = errors.New("child failed")
+	var b strings.Builder
+	if err := r.WriteChromeTrace(&b); err != nil {
+		t.Fatalf("WriteChromeTrace failed: %s", err)
+	}
+	const want = `{"traceEvents":[` +
+		`{"name":"span1","ph":"X","ts":0,"dur":2000,"pid":1,"tid":1,"args":{"id":1}},` +
+		`{"name":"span2","ph":"X","ts":1000,"dur":1000,"pid":1,"tid":1,"args":{"error":"child failed","id":2,"parent":1}}` +
+		`],"displayTimeUnit":"ms"}` + "\n"
+	if got := b.String(); got != want {
+		t.Fatalf("WriteChromeTrace wrote:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestAssignTraceLanesOverlapping(t *testing.T) {
+	r := newTestTraceRecorder(
+		[3]int{0, 0, 100},  // 1: root
+		[3]int{1, 10, 40},  // 2: nested in 1
+		[3]int{1, 30, 60},  // 3: overlaps its sibling 2, so needs a row of its own
+		[3]int{3, 35, 50},  // 4: nested in 3, on 3's row
+		[3]int{1, 70, 90},  // 5: nested in 1 again once 2 has ended
+		[3]int{0, 20, 80},  // 6: an unrelated root that overlaps 1
+		[3]int{1, 95, 120}, // 7: outlives its parent, so cannot be nested in it
+	)
+	lanes := assignTraceLanes(r.Spans())
+	want := []int{1, 1, 3, 3, 1, 2, 2}
+	if fmt.Sprint(lanes) != fmt.Sprint(want) {
+		t.Fatalf("Spans were assigned to rows %v; expected %v", lanes, want)
+	}
+}
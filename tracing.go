@@ -0,0 +1,125 @@
+package asyncobj
+
+import (
+	"errors"
+)
+
+// Span is a timed operation opened by a Tracer.
+type Span interface {
+	// End marks the end of the operation. err is the result of the operation, or nil if it succeeded.
+	End(err error)
+}
+
+// Tracer opens spans on behalf of Helpers. A Helper with a Tracer opens a span for its activation, for its
+// entire shutdown, for its shutdown handler, and for the shutdown of each of its children. Spans opened
+// for an object registered with AddAsyncShutdownChild are children of the span of its parent that was open
+// when it was registered (typically the parent's activation span) or, during shutdown, of the span the
+// parent opened for the child's shutdown.
+//
+// StartSpan may be called while a Helper's lock is held, so it must not call back into a Helper.
+type Tracer interface {
+	// StartSpan opens a new span with the given name. parent is the enclosing span, or nil for a root span.
+	StartSpan(name string, parent Span) Span
+}
+
+// traceParentSetter is implemented by children that can be linked into their parent's trace; that includes
+// *Helper and all objects that embed one.
+type traceParentSetter interface {
+	setTraceParent(tracer Tracer, parent Span)
+}
+
+// SetTracer sets the Tracer that will be used to open spans for the object's activation and shutdown.
+// Children registered with AddAsyncShutdownChild that do not have a tracer of their own inherit it.
+// Cannot be called after activation or shutdown has started.
+func (h *Helper) SetTracer(tracer Tracer) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.state != StateUnactivated || h.isScheduledShutdown {
+		return errors.New("Cannot SetTracer after activation or shutdown has started")
+	}
+	h.tracer = tracer
+	return nil
+}
+
+// setTraceParent sets the span that will be the parent of the next span the helper opens, and sets the
+// helper's tracer if it does not already have one. It is called by a parent Helper when the object is
+// registered as a child and again when the parent begins shutting the child down. It is unexported, but it is
+// promoted to objects that embed a *Helper, so traceParentSetter finds it on them too.
+func (h *Helper) setTraceParent(tracer Tracer, parent Span) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.tracer == nil {
+		h.tracer = tracer
+	}
+	h.traceParent = parent
+}
+
+// lockedStartSpan opens a span named after the object and the operation if tracing is enabled, or returns
+// nil. If parent is nil, the parent span set with setTraceParent is used. The lock must be held when this
+// method is called.
+func (h *Helper) lockedStartSpan(operation string, parent Span) Span {
+	if h.tracer == nil {
+		return nil
+	}
+	if parent == nil {
+		parent = h.traceParent
+	}
+	return h.tracer.StartSpan(h.lockedAsyncObjName()+": "+operation, parent)
+}
+
+// startSpan is the same as lockedStartSpan, but must be called without the lock held.
+func (h *Helper) startSpan(operation string, parent Span) Span {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	return h.lockedStartSpan(operation, parent)
+}
+
+// endSpan ends a span opened by startSpan, if it is not nil
+func endSpan(span Span, err error) {
+	if span != nil {
+		span.End(err)
+	}
+}
+
+// startChildSpan opens a span for the shutdown of a child, as a child of the helper's shutdown span, if
+// tracing is enabled; otherwise it returns nil. If the child can be linked into the trace, the new span
+// becomes the parent of its own shutdown spans. The lock must not be held when this method is called.
+func (h *Helper) startChildSpan(reg *childRegistration) Span {
+	return h.startChildOperationSpan(reg, "shutdown child", h.shutdownSpan)
+}
+
+// startChildOperationSpan opens a span for an operation on a child, as a child of parent, if tracing is
+// enabled; otherwise it returns nil. If the child can be linked into the trace, the new span becomes the
+// parent of the child's own spans. The lock must not be held when this method is called.
+func (h *Helper) startChildOperationSpan(reg *childRegistration, operation string, parent Span) Span {
+	h.Lock.Lock()
+	tracer := h.tracer
+	h.Lock.Unlock()
+	if tracer == nil {
+		return nil
+	}
+	span := h.startSpan(operation+" "+reg.describe(), parent)
+	if setter, ok := reg.asyncChild.(traceParentSetter); ok {
+		setter.setTraceParent(tracer, span)
+	}
+	return span
+}
+
+// linkChildTrace passes the tracer and a parent span to a newly registered child, if tracing is enabled
+// and the child can be linked. The lock must not be held when this method is called.
+func (h *Helper) linkChildTrace(child AsyncShutdowner) {
+	setter, ok := child.(traceParentSetter)
+	if !ok {
+		return
+	}
+	h.Lock.Lock()
+	tracer := h.tracer
+	parent := h.currentSpan
+	if parent == nil {
+		parent = h.traceParent
+	}
+	h.Lock.Unlock()
+	if tracer != nil {
+		setter.setTraceParent(tracer, parent)
+	}
+}
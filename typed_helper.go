@@ -0,0 +1,128 @@
+package asyncobj
+
+import (
+	"context"
+	"sync"
+)
+
+// TypedObject is the constraint on objects managed by a TypedHelper. It requires the shutdown handler and a
+// typed activation handler, so a missing handler is a compile-time error rather than a runtime panic.
+type TypedObject[R any] interface {
+	HandleOnceShutdowner
+
+	// HandleOnceActivateTyped is called exactly once, in StateActivating, with shutdown deferred, to activate
+	// the object. ctx is cancelled if shutdown is scheduled while activation is in progress. If it returns a
+	// nil error, the object will be activated and the returned value is retained as the activation result.
+	// If it returns an error, the object will not be activated, and shutdown will be immediately started.
+	HandleOnceActivateTyped(ctx context.Context) (R, error)
+}
+
+// TypedHelper is a Helper for an object of a known type T, whose activation produces a value of type R
+// (for example, the address a server is listening on). Use struct{} for R if activation produces nothing.
+// Like Helper, it is typically embedded in the object being managed.
+type TypedHelper[T TypedObject[R], R any] struct {
+	*Helper
+
+	// obj is the object being managed
+	obj T
+
+	// resultLock protects result and hasResult
+	resultLock sync.Mutex
+
+	// result is the value returned by successful activation
+	result R
+
+	// hasResult is true once activation has succeeded
+	hasResult bool
+}
+
+// NewTypedHelper creates a new TypedHelper for obj.
+// if logger is nil, a NilLogger is attached.
+func NewTypedHelper[T TypedObject[R], R any](logger Logger, obj T) *TypedHelper[T, R] {
+	h := &TypedHelper[T, R]{obj: obj}
+	// T is known to implement HandleOnceShutdowner, so the helper will find the shutdown handler on obj
+	h.Helper = NewHelperWithShutdownHandler(obj, logger, nil).(*Helper)
+	return h
+}
+
+// Obj returns the object being managed
+func (h *TypedHelper[T, R]) Obj() T {
+	return h.obj
+}
+
+// Activate activates the object once, as with DoOnceActivateContext, using the object's
+// HandleOnceActivateTyped method, and returns the activation result. If the object has already been
+// successfully activated, the result of that activation is returned.
+func (h *TypedHelper[T, R]) Activate(ctx context.Context, waitOnFail bool) (R, error) {
+	err := h.Helper.DoOnceActivateContext(ctx, h.activateTyped, waitOnFail)
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	result, _ := h.ActivationValue()
+	return result, nil
+}
+
+// ActivationValue returns the value returned by the object's HandleOnceActivateTyped method, and true,
+// if activation has succeeded. Otherwise it returns the zero value of R and false. The activation error,
+// if any, is available from ActivationResult.
+func (h *TypedHelper[T, R]) ActivationValue() (R, bool) {
+	h.resultLock.Lock()
+	defer h.resultLock.Unlock()
+	return h.result, h.hasResult
+}
+
+// DoOnceActivate is the same as Helper.DoOnceActivate, except that if onceActivateCallback is nil, the
+// object's HandleOnceActivateTyped method is used.
+func (h *TypedHelper[T, R]) DoOnceActivate(onceActivateCallback OnceActivateCallback, waitOnFail bool) error {
+	if onceActivateCallback == nil {
+		return h.Helper.DoOnceActivateContext(context.Background(), h.activateTyped, waitOnFail)
+	}
+	return h.Helper.DoOnceActivate(onceActivateCallback, waitOnFail)
+}
+
+// DoOnceActivateContext is the same as Helper.DoOnceActivateContext, except that if onceActivateCallback
+// is nil, the object's HandleOnceActivateTyped method is used.
+func (h *TypedHelper[T, R]) DoOnceActivateContext(
+	ctx context.Context,
+	onceActivateCallback OnceActivateContextCallback,
+	waitOnFail bool,
+) error {
+	if onceActivateCallback == nil {
+		onceActivateCallback = h.activateTyped
+	}
+	return h.Helper.DoOnceActivateContext(ctx, onceActivateCallback, waitOnFail)
+}
+
+// StartActivate is the same as Helper.StartActivate, except that if onceActivateCallback is nil, the
+// object's HandleOnceActivateTyped method is used.
+func (h *TypedHelper[T, R]) StartActivate(onceActivateCallback OnceActivateCallback) {
+	if onceActivateCallback == nil {
+		h.Helper.StartActivateContext(context.Background(), h.activateTyped)
+		return
+	}
+	h.Helper.StartActivate(onceActivateCallback)
+}
+
+// StartActivateContext is the same as Helper.StartActivateContext, except that if onceActivateCallback
+// is nil, the object's HandleOnceActivateTyped method is used.
+func (h *TypedHelper[T, R]) StartActivateContext(ctx context.Context, onceActivateCallback OnceActivateContextCallback) {
+	if onceActivateCallback == nil {
+		onceActivateCallback = h.activateTyped
+	}
+	h.Helper.StartActivateContext(ctx, onceActivateCallback)
+}
+
+// activateTyped is the activation callback that calls the object's HandleOnceActivateTyped method
+// and retains the result.
+func (h *TypedHelper[T, R]) activateTyped(ctx context.Context) error {
+	result, err := h.obj.HandleOnceActivateTyped(ctx)
+	if err != nil {
+		return err
+	}
+	h.resultLock.Lock()
+	defer h.resultLock.Unlock()
+	h.result = result
+	h.hasResult = true
+	return nil
+}
@@ -0,0 +1,83 @@
+package asyncobj
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// typedServer is an object managed by a TypedHelper whose activation produces its address
+type typedServer struct {
+	*TypedHelper[*typedServer, string]
+
+	// activateErr is returned by activation if it is not nil
+	activateErr error
+
+	// activations counts the calls to HandleOnceActivateTyped
+	activations int
+
+	// stopped is set by HandleOnceShutdown
+	stopped bool
+}
+
+func newTypedServer(activateErr error) *typedServer {
+	s := &typedServer{activateErr: activateErr}
+	s.TypedHelper = NewTypedHelper[*typedServer, string](nil, s)
+	return s
+}
+
+func (s *typedServer) HandleOnceActivateTyped(ctx context.Context) (string, error) {
+	s.activations++
+	if s.activateErr != nil {
+		return "", s.activateErr
+	}
+	return "localhost:8080", nil
+}
+
+func (s *typedServer) HandleOnceShutdown(completionErr error) error {
+	s.stopped = true
+	return completionErr
+}
+
+func TestTypedHelperActivate(t *testing.T) {
+	s := newTypedServer(nil)
+	if s.Obj() != s {
+		t.Fatal("Obj did not return the managed object")
+	}
+	if _, ok := s.ActivationValue(); ok {
+		t.Fatal("ActivationValue reported a result before activation")
+	}
+	addr, err := s.Activate(context.Background(), true)
+	if err != nil || addr != "localhost:8080" {
+		t.Fatalf("Activate returned %q, %v; expected the server's address", addr, err)
+	}
+	// A second activation returns the same result without activating again
+	addr, err = s.Activate(context.Background(), true)
+	if err != nil || addr != "localhost:8080" || s.activations != 1 {
+		t.Fatalf("Second Activate returned %q, %v after %d activations", addr, err, s.activations)
+	}
+	if addr, ok := s.ActivationValue(); !ok || addr != "localhost:8080" {
+		t.Fatalf("ActivationValue returned %q, %t", addr, ok)
+	}
+	if err := s.Close(); err != nil || !s.stopped {
+		t.Fatalf("Close returned %v, stopped=%t; expected the object's shutdown handler to run", err, s.stopped)
+	}
+}
+
+func TestTypedHelperActivateFailure(t *testing.T) {
+	activateErr := errors.New("listen failed")
+	s := newTypedServer(activateErr)
+	// With a nil callback, DoOnceActivate uses the object's typed activation handler
+	if err := s.DoOnceActivate(nil, true); err != activateErr {
+		t.Fatalf("DoOnceActivate returned %v; expected %v", err, activateErr)
+	}
+	if addr, ok := s.ActivationValue(); ok || addr != "" {
+		t.Fatalf("ActivationValue returned %q, %t after activation failed", addr, ok)
+	}
+	if addr, err := s.Activate(context.Background(), true); err != activateErr || addr != "" {
+		t.Fatalf("Activate returned %q, %v after activation failed; expected %v", addr, err, activateErr)
+	}
+	if !s.stopped || s.activations != 1 {
+		t.Fatalf("stopped=%t after %d activations; expected the failed activation to shut the object down", s.stopped, s.activations)
+	}
+}
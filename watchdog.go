@@ -0,0 +1,203 @@
+package asyncobj
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Shutdown phases reported by the shutdown watchdog
+const (
+	phaseDraining        = "draining in-flight operations"
+	phaseShutdownHandler = "running shutdown handler"
+	phaseChildren        = "waiting for children"
+	phaseWaitGroup       = "waiting for ShutdownWG"
+)
+
+// abandonedShutdownHandlerName identifies a shutdown handler that has been abandoned but is still running
+// in diagnostics
+const abandonedShutdownHandlerName = "abandoned shutdown handler"
+
+// SetAsyncObjName sets the name used to identify the object in diagnostics such as the shutdown
+// watchdog's reports. The default is derived from the type and address of the managed object.
+func (h *Helper) SetAsyncObjName(name string) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	h.name = name
+	if h.leakTracker != nil {
+		h.leakTracker.setNameAndLogger(h.lockedAsyncObjName(), h.lg)
+	}
+}
+
+// AsyncObjName returns the name used to identify the object in diagnostics.
+func (h *Helper) AsyncObjName() string {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	return h.lockedAsyncObjName()
+}
+
+// lockedAsyncObjName returns the name used to identify the object in diagnostics.
+// The lock must be held when this method is called.
+func (h *Helper) lockedAsyncObjName() string {
+	if h.name != "" {
+		return h.name
+	}
+	if h.obj != nil {
+		// Don't ask obj for its name; it is probably asking us
+		return objectIdentity(h.obj)
+	}
+	return objectIdentity(h)
+}
+
+// asyncObjNamer is implemented by objects that can name themselves for diagnostics, including
+// *Helper and all objects that embed one.
+type asyncObjNamer interface {
+	AsyncObjName() string
+}
+
+// describeObject returns a name for an arbitrary object (typically a child) for use in diagnostics.
+func describeObject(obj interface{}) string {
+	if namer, ok := obj.(asyncObjNamer); ok {
+		return namer.AsyncObjName()
+	}
+	return objectIdentity(obj)
+}
+
+// objectIdentity returns a name for an object derived from its type and, if it is a pointer, its address.
+func objectIdentity(obj interface{}) string {
+	if reflect.ValueOf(obj).Kind() == reflect.Ptr {
+		return fmt.Sprintf("%T@%p", obj, obj)
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+// describe returns a name for the registered child for use in diagnostics.
+func (reg *childRegistration) describe() string {
+	if reg.asyncChild != nil {
+		return describeObject(reg.asyncChild)
+	}
+	if reg.closer != nil {
+		return describeObject(reg.closer)
+	}
+	return fmt.Sprintf("chan@%p", reg.doneChan)
+}
+
+// SetShutdownWatchdog enables a watchdog that reports, through Lg(), objects that appear to be stuck
+// during shutdown. If any phase of shutdown (draining in-flight operations, running the shutdown handler,
+// waiting for children, or waiting for the ShutdownWG) lasts longer than threshold, the watchdog logs a warning containing the object's
+// name, its State, the children it is still waiting on, the goroutines started with Go that have not
+// returned, the total count added with ShutdownWGAdd, and a dump of all goroutine stacks. The report is
+// repeated, with the interval doubling each time up to maxInterval, until the phase ends. If maxInterval
+// is <= 0, the interval doubles without limit. A threshold <= 0 disables the watchdog, which is the default.
+// Cannot be called after shutdown has started.
+func (h *Helper) SetShutdownWatchdog(threshold time.Duration, maxInterval time.Duration) error {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	if h.lockedIsStartedShutdown() {
+		return errors.New("Cannot SetShutdownWatchdog after shutdown has started")
+	}
+	h.watchdogThreshold = threshold
+	h.watchdogMaxInterval = maxInterval
+	return nil
+}
+
+// lockedSetShutdownPhase records the start of a new phase of shutdown for the watchdog.
+// The lock must be held when this method is called.
+func (h *Helper) lockedSetShutdownPhase(phase string) {
+	h.shutdownPhase = phase
+	h.shutdownPhaseStart = time.Now()
+}
+
+// runShutdownWatchdog is the watchdog goroutine, started upon entering StateDraining or StateShuttingDown,
+// whichever comes first, if the watchdog is enabled. It exits when shutdown is complete.
+func (h *Helper) runShutdownWatchdog() {
+	h.Lock.Lock()
+	phaseStart := h.shutdownPhaseStart
+	h.Lock.Unlock()
+	interval := h.watchdogThreshold
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-h.shutdownDoneChan:
+			return
+		case <-timer.C:
+		}
+		h.Lock.Lock()
+		if !h.shutdownPhaseStart.Equal(phaseStart) {
+			// A new phase has started since the timer was set; give it the full threshold
+			phaseStart = h.shutdownPhaseStart
+			h.Lock.Unlock()
+			interval = h.watchdogThreshold
+			timer.Reset(interval - time.Since(phaseStart))
+			continue
+		}
+		h.Lock.Unlock()
+		h.lg.WLogf("%s\n%s", h.shutdownReport(), goroutineDump())
+		interval *= 2
+		if h.watchdogMaxInterval > 0 && interval > h.watchdogMaxInterval {
+			interval = h.watchdogMaxInterval
+		}
+		timer.Reset(interval)
+	}
+}
+
+// shutdownReport describes what a stuck shutdown is waiting on.
+func (h *Helper) shutdownReport() string {
+	var b strings.Builder
+	h.Lock.Lock()
+	fmt.Fprintf(&b, "Shutdown of \"%s\" has been %s for %s (state=%s)",
+		h.lockedAsyncObjName(), h.shutdownPhase, time.Since(h.shutdownPhaseStart).Round(time.Millisecond), h.state)
+	children := make([]*childRegistration, 0, len(h.pendingChildren))
+	for reg := range h.pendingChildren {
+		children = append(children, reg)
+	}
+	goroutines := make([]string, 0, len(h.runningGoroutines)+1)
+	for name, n := range h.runningGoroutines {
+		goroutines = append(goroutines, fmt.Sprintf("%s (%d)", name, n))
+	}
+	if h.isShutdownHandlerAbandoned {
+		goroutines = append(goroutines, abandonedShutdownHandlerName)
+	}
+	wgAddTotal := h.wgAddTotal
+	inFlight := -1
+	if h.state == StateDraining {
+		inFlight = h.inFlightOperations
+	}
+	h.Lock.Unlock()
+
+	if inFlight >= 0 {
+		fmt.Fprintf(&b, "; in-flight operations: %d", inFlight)
+	}
+	// Children are described without holding the lock, since they may have to lock themselves
+	if len(children) > 0 {
+		names := make([]string, len(children))
+		for i, reg := range children {
+			names[i] = reg.describe()
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, "; outstanding children: %s", strings.Join(names, ", "))
+	}
+	if len(goroutines) > 0 {
+		sort.Strings(goroutines)
+		fmt.Fprintf(&b, "; running goroutines: %s", strings.Join(goroutines, ", "))
+	}
+	fmt.Fprintf(&b, "; total added with ShutdownWGAdd: %d", wgAddTotal)
+	return b.String()
+}
+
+// goroutineDump returns the stacks of all goroutines.
+func goroutineDump() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
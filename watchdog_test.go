@@ -0,0 +1,30 @@
+package asyncobj
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShutdownReportWGTotal(t *testing.T) {
+	h := newTestHelper()
+	wg1, _ := h.ShutdownWGAdd(1)
+	wg2, _ := h.ShutdownWGAdd(2)
+	if wg1 != wg2 {
+		t.Fatal("ShutdownWGAdd returned different waitgroups")
+	}
+	h.StartShutdown(nil)
+	<-h.LocalShutdownDoneChan()
+	if report := h.shutdownReport(); !strings.Contains(report, "total added with ShutdownWGAdd: 3") {
+		t.Fatalf("Unexpected report: %s", report)
+	}
+	// Done may be called on the waitgroup returned by any call
+	wg1.Done()
+	wg1.Done()
+	if h.IsDoneShutdown() {
+		t.Fatal("Shutdown completed while the ShutdownWG was held")
+	}
+	wg2.Done()
+	if err := h.WaitShutdown(); err != nil {
+		t.Fatalf("WaitShutdown returned %s", err)
+	}
+}